@@ -0,0 +1,201 @@
+// Package client is typed client of the blog API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trapck/go-rest-api/server"
+)
+
+// Client calls the blog API. Token of the user who registered, logged in or updated itself last is sent with next requests.
+// Client is safe for concurrent use
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	mu         sync.RWMutex
+	token      string
+}
+
+// Option configures Client
+type Option func(*Client)
+
+// WithHTTPClient makes Client send requests with c instead of http.DefaultClient
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithToken makes Client authenticate requests with token got earlier
+func WithToken(token string) Option {
+	return func(client *Client) {
+		client.token = token
+	}
+}
+
+// New creates client of the API served at baseURL, e.g. "http://localhost:3000"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns current auth token. It is empty until user registers or logs in
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// SetToken replaces current auth token. Empty token makes next requests anonymous
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Register creates user and authenticates next requests as this user
+func (c *Client) Register(ctx context.Context, u server.RequestUserData) (server.ResponseUserData, error) {
+	return c.authenticate(ctx, http.MethodPost, "/api/users", server.RequestUser{User: u})
+}
+
+// Login authenticates next requests as user with the username and password
+func (c *Client) Login(ctx context.Context, username, password string) (server.ResponseUserData, error) {
+	u := server.RequestUserData{CommonUserData: server.CommonUserData{UserName: username}, Password: password}
+	return c.authenticate(ctx, http.MethodPost, "/api/users/login", server.RequestUser{User: u})
+}
+
+// GetCurrentUser returns user of the current token
+func (c *Client) GetCurrentUser(ctx context.Context) (server.ResponseUserData, error) {
+	var resp server.ResponseUser
+	e := c.do(ctx, http.MethodGet, "/api/user", nil, nil, &resp)
+	return resp.User, e
+}
+
+// UpdateUser changes fields of current user which are set in data. Version of the user is required.
+// Username is part of the token, so the token is replaced with the new one
+func (c *Client) UpdateUser(ctx context.Context, data server.UpdateUserData) (server.ResponseUserData, error) {
+	return c.authenticate(ctx, http.MethodPut, "/api/user", server.UpdateUserRequest{User: data})
+}
+
+// GetArticle returns article by slug. Renamed articles are found by their previous slugs too
+func (c *Client) GetArticle(ctx context.Context, slug string) (server.Article, error) {
+	var resp server.SingleArticleHTTPWrap
+	e := c.do(ctx, http.MethodGet, server.ArticlesPath+url.PathEscape(slug), nil, nil, &resp)
+	return resp.Article, e
+}
+
+// CreateArticle creates article of current user
+func (c *Client) CreateArticle(ctx context.Context, a server.Article) (server.Article, error) {
+	var resp server.Article
+	e := c.do(ctx, http.MethodPost, "/api/articles", nil, server.SingleArticleHTTPWrap{Article: a}, &resp)
+	return resp, e
+}
+
+// UpdateArticle changes article with the slug. a.Version must be version of the article the changes are based on
+func (c *Client) UpdateArticle(ctx context.Context, slug string, a server.Article) (server.Article, error) {
+	var resp server.SingleArticleHTTPWrap
+	e := c.do(ctx, http.MethodPut, server.ArticlesPath+url.PathEscape(slug), nil, server.SingleArticleHTTPWrap{Article: a}, &resp)
+	return resp.Article, e
+}
+
+// ListArticles returns page of articles from newest to oldest. Pass Next or Prev of a page as cursor to get adjacent page.
+// Zero limit is default page size of the server
+func (c *Client) ListArticles(ctx context.Context, limit int, cursor string) (server.ArticleListResponse, error) {
+	params := url.Values{}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	var resp server.ArticleListResponse
+	e := c.do(ctx, http.MethodGet, "/api/articles", params, nil, &resp)
+	return resp, e
+}
+
+// SearchArticles returns page of articles matching q.Text ordered by relevance. Zero limit is default page size of the server
+func (c *Client) SearchArticles(ctx context.Context, q server.ArticleSearchQuery) (server.ArticleSearchResult, error) {
+	params := url.Values{"q": {q.Text}}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		params.Set("offset", strconv.Itoa(q.Offset))
+	}
+	var resp server.ArticleSearchResult
+	e := c.do(ctx, http.MethodGet, server.ArticleSearchPath, params, nil, &resp)
+	return resp, e
+}
+
+// authenticate sends request which responds with user and its token, and keeps the token for next requests
+func (c *Client) authenticate(ctx context.Context, method, path string, body interface{}) (server.ResponseUserData, error) {
+	var resp server.ResponseUser
+	if e := c.do(ctx, method, path, nil, body, &resp); e != nil {
+		return resp.User, e
+	}
+	c.SetToken(resp.User.Token)
+	return resp.User, nil
+}
+
+// do sends request with json body and decodes json response to out. Unsuccessful responses are returned as *APIError
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, e := json.Marshal(body)
+		if e != nil {
+			return e
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	u := c.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, e := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if e != nil {
+		return e
+	}
+	if body != nil {
+		req.Header.Set(server.HeaderKeyContentType, server.HeaderValueJSONContactType)
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set(server.HeaderKeyAuthorization, server.AuthHeader0Part+" "+token)
+	}
+	resp, e := c.httpClient.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return newAPIError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// newAPIError reads unsuccessful response
+func newAPIError(resp *http.Response) *APIError {
+	e := &APIError{StatusCode: resp.StatusCode}
+	b, _ := ioutil.ReadAll(resp.Body)
+	var body server.UnprocessableEntityResponse
+	if json.Unmarshal(b, &body) == nil {
+		e.Messages = body.Errors.Body
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get(server.HeaderKeyRetryAfter)); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	e.kind = errorKind(e.StatusCode, e.Messages)
+	return e
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trapck/go-rest-api/server"
+)
+
+func newTestClient(t *testing.T, opts ...server.ServerOption) *Client {
+	t.Helper()
+	s := httptest.NewServer(server.NewBlogServer(server.NewInMemoryBlogStore(), opts...))
+	t.Cleanup(s.Close)
+	return New(s.URL, WithHTTPClient(s.Client()))
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	user := server.RequestUserData{CommonUserData: server.CommonUserData{UserName: "author", Email: "author@mail.com"}, Password: "secret"}
+
+	t.Run("should keep token of registered user", func(t *testing.T) {
+		u, err := c.Register(ctx, user)
+		assert.NoError(t, err)
+		assert.Equal(t, user.UserName, u.UserName)
+		assert.NotEmpty(t, c.Token())
+		current, err := c.GetCurrentUser(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, user.Email, current.Email)
+	})
+
+	t.Run("should create, get and update article", func(t *testing.T) {
+		created, err := c.CreateArticle(ctx, server.Article{Title: "Client article", Body: "body"})
+		assert.NoError(t, err)
+		a, err := c.GetArticle(ctx, created.Slug)
+		assert.NoError(t, err)
+		assert.Equal(t, "body", a.Body)
+		assert.Equal(t, user.UserName, a.Author.UserName)
+
+		a.Title = "Renamed article"
+		a.Body = "new body"
+		updated, err := c.UpdateArticle(ctx, a.Slug, a)
+		assert.NoError(t, err)
+		assert.Equal(t, a.Version+1, updated.Version)
+		got, err := c.GetArticle(ctx, updated.Slug)
+		assert.NoError(t, err)
+		assert.Equal(t, "new body", got.Body)
+
+		_, err = c.UpdateArticle(ctx, updated.Slug, a)
+		assert.True(t, errors.Is(err, server.ErrVersionConflict), "expected version conflict, got %v", err)
+	})
+
+	t.Run("should list and search articles", func(t *testing.T) {
+		page, err := c.ListArticles(ctx, 1, "")
+		assert.NoError(t, err)
+		assert.Len(t, page.Articles, 1)
+		found, err := c.SearchArticles(ctx, server.ArticleSearchQuery{Text: "renamed"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, found.Total)
+	})
+
+	t.Run("should replace token after username change", func(t *testing.T) {
+		current, _ := c.GetCurrentUser(ctx)
+		username := "new-author"
+		u, err := c.UpdateUser(ctx, server.UpdateUserData{UserName: &username, Version: &current.Version})
+		assert.NoError(t, err)
+		assert.Equal(t, u.Token, c.Token())
+		current, err = c.GetCurrentUser(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, username, current.UserName)
+	})
+
+	t.Run("should login with changed username", func(t *testing.T) {
+		anonymous := New(c.baseURL, WithHTTPClient(c.httpClient))
+		_, err := anonymous.Login(ctx, "new-author", user.Password)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, anonymous.Token())
+	})
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, server.WithRateLimits(server.RateLimits{Auth: server.NewTokenBucketLimiter(2, time.Minute)}))
+	user := server.RequestUserData{CommonUserData: server.CommonUserData{UserName: "user", Email: "user@mail.com"}, Password: "secret"}
+
+	t.Run("should map statuses and messages to errors", func(t *testing.T) {
+		_, err := c.GetCurrentUser(ctx)
+		assert.True(t, errors.Is(err, ErrUnauthorized), "expected unauthorized, got %v", err)
+		_, err = c.GetArticle(ctx, "missing")
+		assert.True(t, errors.Is(err, server.ErrNotFound), "expected not found, got %v", err)
+		_, err = c.SearchArticles(ctx, server.ArticleSearchQuery{})
+		assert.True(t, errors.Is(err, ErrInvalidRequest), "expected invalid request, got %v", err)
+
+		_, err = c.Register(ctx, user)
+		assert.NoError(t, err)
+		_, err = c.Register(ctx, user)
+		assert.True(t, errors.Is(err, server.ErrAlreadyExists), "expected already exists, got %v", err)
+		var apiErr *APIError
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, []string{server.MsgUserAlreadyExists}, apiErr.Messages)
+		}
+	})
+
+	t.Run("should report retry delay of limited requests", func(t *testing.T) {
+		_, err := c.Login(ctx, user.UserName, user.Password)
+		assert.True(t, errors.Is(err, ErrTooManyRequests), "expected too many requests, got %v", err)
+		var apiErr *APIError
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.True(t, apiErr.RetryAfter > 0, "expected retry delay")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trapck/go-rest-api/server"
+)
+
+// Errors of API responses. Errors returned by Client wrap them, so compare them with errors.Is.
+// Missing resources, taken titles or usernames and outdated versions are reported with server store errors
+var (
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrInvalidRequest       = errors.New("invalid request")
+	ErrLocked               = errors.New("account is locked")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrTooManyRequests      = errors.New("too many requests")
+	ErrUnavailable          = errors.New("service unavailable")
+)
+
+// APIError is unsuccessful API response. Messages are errors.body of the response if it has one
+type APIError struct {
+	StatusCode int
+	Messages   []string
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Messages) > 0 {
+		msg += ": " + strings.Join(e.Messages, "; ")
+	}
+	return msg
+}
+
+// Unwrap returns error kind of the response status and messages
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// errorKind returns sentinel error of response status and messages
+func errorKind(status int, messages []string) error {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return server.ErrNotFound
+	case http.StatusPreconditionFailed:
+		return server.ErrVersionConflict
+	case http.StatusUnprocessableEntity:
+		for _, m := range messages {
+			if m == server.MsgUserAlreadyExists || m == server.MsgArticleAlreadyExists {
+				return server.ErrAlreadyExists
+			}
+		}
+		return ErrInvalidRequest
+	case http.StatusLocked:
+		return ErrLocked
+	case http.StatusPreconditionRequired:
+		return ErrPreconditionRequired
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+
+	"github.com/trapck/go-rest-api/config"
+)
+
+var logLevels = map[string]int{
+	config.LogLevelDebug: 0,
+	config.LogLevelInfo:  1,
+	config.LogLevelWarn:  2,
+	config.LogLevelError: 3,
+}
+
+// leveledLogger writes messages of configured level and above to standard logger
+type leveledLogger struct {
+	level int
+}
+
+func newLeveledLogger(level string) leveledLogger {
+	return leveledLogger{level: logLevels[level]}
+}
+
+func (l leveledLogger) Debugf(format string, v ...interface{}) {
+	l.logf(config.LogLevelDebug, format, v...)
+}
+
+func (l leveledLogger) Infof(format string, v ...interface{}) {
+	l.logf(config.LogLevelInfo, format, v...)
+}
+
+func (l leveledLogger) Warnf(format string, v ...interface{}) {
+	l.logf(config.LogLevelWarn, format, v...)
+}
+
+func (l leveledLogger) Errorf(format string, v ...interface{}) {
+	l.logf(config.LogLevelError, format, v...)
+}
+
+func (l leveledLogger) logf(level, format string, v ...interface{}) {
+	if logLevels[level] >= l.level {
+		log.Printf(level+": "+format, v...)
+	}
+}
@@ -1,33 +1,129 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/trapck/go-rest-api/config"
 	"github.com/trapck/go-rest-api/server"
 )
 
-// InMemoryBlogStore stores blogs in memory
-type InMemoryBlogStore struct{}
-
-// GetArticle returns article from in memory blog store
-func (s *InMemoryBlogStore) GetArticle(search string) (article server.Article, e error) {
-	return server.Article{Slug: "found-article-from-fake-store", Title: "found article from fake store"}, nil
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "print resulting config with secrets redacted and exit")
+	cfg, err := config.Load(fs, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printConfig {
+		fmt.Println(cfg)
+		return
+	}
+	switch args := fs.Args(); {
+	case len(args) == 0:
+		err = run(cfg, newLeveledLogger(cfg.LogLevel))
+	case args[0] == "migrate":
+		err = runMigrate(cfg, args[1:], os.Stdout)
+	case args[0] == "unlock":
+		err = runUnlock(cfg, args[1:], os.Stdout)
+	default:
+		err = fmt.Errorf("unknown command %q", args[0])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-// CreateArticle returns article from in memory blog store
-func (s *InMemoryBlogStore) CreateArticle(a server.SingleArticleHTTPWrap) (article server.Article, e error) {
-	return server.Article{Slug: "created-fake-article", Title: "created fake article"}, nil
+// newRateLimiter returns in memory limiter or nil if limit is disabled
+func newRateLimiter(c config.RateLimitConfig) server.RateLimiter {
+	if c.Requests == 0 {
+		return nil
+	}
+	return server.NewTokenBucketLimiter(c.Requests, c.Period.Duration)
 }
 
-func main() {
-	store := server.DBBlogStore{}
-	if err := store.Init(); err != nil {
-		log.Fatalf("could not open db connection %q", err)
+func run(cfg config.Config, logger leveledLogger) error {
+	logger.Debugf("starting with config %s", cfg)
+	server.ConfigureAuth(cfg.JWT.Secret, cfg.JWT.TTL.Duration)
+	trustedProxies, err := server.ParseTrustedProxies(cfg.RateLimits.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		return err
 	}
-	defer store.Close()
-	s := server.NewBlogServer(&store)
-	if err := http.ListenAndServe(":3000", s); err != nil {
-		log.Fatalf("could not listen on port 3000 %v", err)
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Errorf("could not close store %q", err)
+		}
+	}()
+
+	opts := []server.ServerOption{}
+	if cfg.Cache.Size > 0 {
+		cache := server.NewCachingBlogStore(store, server.CacheOptions{Size: cfg.Cache.Size, TTL: cfg.Cache.TTL.Duration})
+		opts = append(opts, server.WithMetrics("store_cache", func() interface{} { return cache.Stats() }))
+		store = cache
+	}
+	if cfg.Compression.Enabled {
+		opts = append(opts, server.WithCompression(server.CompressionOptions{MinSize: cfg.Compression.MinSize}))
+	}
+	s := server.NewBlogServer(store, append(opts, server.WithCORS(server.CORSOptions{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge.Duration,
+	}), server.WithRateLimits(server.RateLimits{
+		Auth:           newRateLimiter(cfg.RateLimits.Auth),
+		Write:          newRateLimiter(cfg.RateLimits.Write),
+		TrustedProxies: trustedProxies,
+	}), server.WithLockout(server.LockoutPolicy{
+		MaxFailures:     cfg.Lockout.MaxFailures,
+		LockDuration:    cfg.Lockout.Duration.Duration,
+		MaxLockDuration: cfg.Lockout.MaxDuration.Duration,
+	}))...)
+	httpServer := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      s,
+		ReadTimeout:  cfg.Timeouts.Read.Duration,
+		WriteTimeout: cfg.Timeouts.Write.Duration,
+		IdleTimeout:  cfg.Timeouts.Idle.Duration,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Infof("listening on %s", cfg.Addr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("could not listen on %s %v", cfg.Addr, err)
+	case sig := <-stop:
+		logger.Infof("got %v, shutting down", sig)
+	}
+
+	s.StartDraining()
+	time.Sleep(cfg.Timeouts.DrainDelay.Duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown.Duration)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("could not drain in-flight requests %v", err)
 	}
+	logger.Infof("server stopped")
+	return nil
 }
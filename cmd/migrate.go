@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/trapck/go-rest-api/config"
+	"github.com/trapck/go-rest-api/server"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+func runMigrate(cfg config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+	if isMemoryDSN(cfg.DSN) {
+		return fmt.Errorf("in memory store does not need migrations")
+	}
+	store, err := openSQLStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp()
+		printMigrations(out, "applied", applied)
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+		}
+		reverted, err := store.MigrateDown(steps)
+		printMigrations(out, "reverted", reverted)
+		return err
+	case "status":
+		statuses, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt.Valid {
+				appliedAt = s.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, %s", args[0], migrateUsage)
+	}
+}
+
+func printMigrations(out io.Writer, action string, migrations []server.Migration) {
+	for _, m := range migrations {
+		fmt.Fprintf(out, "%s %d %s\n", action, m.Version, m.Name)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trapck/go-rest-api/config"
+	"github.com/trapck/go-rest-api/server"
+)
+
+// memoryDSNScheme selects in memory blog store which keeps data until the process exits
+const memoryDSNScheme = "memory:"
+
+type blogStore interface {
+	server.BlogStore
+	Close() error
+}
+
+// sqlStore is blog store backed by sql db with schema migrations
+type sqlStore interface {
+	blogStore
+	Init() error
+	MigrateUp() ([]server.Migration, error)
+	MigrateDown(steps int) ([]server.Migration, error)
+	MigrationStatus() ([]server.MigrationStatus, error)
+}
+
+// openStore creates blog store selected by dsn scheme
+func openStore(cfg config.Config, logger leveledLogger) (blogStore, error) {
+	if isMemoryDSN(cfg.DSN) {
+		logger.Warnf("using in memory store, data will be lost on exit")
+		return server.NewInMemoryBlogStore(), nil
+	}
+	store, err := openSQLStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AutoMigrate {
+		applied, err := store.MigrateUp()
+		for _, m := range applied {
+			logger.Infof("applied migration %d %s", m.Version, m.Name)
+		}
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("could not migrate db %v", err)
+		}
+	}
+	return store, nil
+}
+
+// newSQLiteStore creates SQLite store. It is set only in binaries built with cgo, which SQLite driver requires
+var newSQLiteStore func(db server.DBBlogStore) sqlStore
+
+// openSQLStore connects to SQLite for dsn with sqlite: scheme and to Postgres otherwise
+func openSQLStore(cfg config.Config) (sqlStore, error) {
+	db := server.DBBlogStore{DSN: cfg.DSN, QueryTimeout: cfg.Timeouts.Query.Duration, MaxTxRetries: cfg.MaxTxRetries}
+	var store sqlStore = &db
+	if server.IsSQLiteDSN(cfg.DSN) {
+		if newSQLiteStore == nil {
+			return nil, fmt.Errorf("sqlite store is not available in binary built without cgo")
+		}
+		store = newSQLiteStore(db)
+	}
+	if err := store.Init(); err != nil {
+		return nil, fmt.Errorf("could not open db connection %q", err)
+	}
+	return store, nil
+}
+
+func isMemoryDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, memoryDSNScheme)
+}
@@ -0,0 +1,15 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"github.com/trapck/go-rest-api/server"
+	"github.com/trapck/go-rest-api/server/sqlite"
+)
+
+func init() {
+	newSQLiteStore = func(db server.DBBlogStore) sqlStore {
+		return &sqlite.BlogStore{DBBlogStore: db}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/trapck/go-rest-api/config"
+)
+
+const unlockUsage = "usage: unlock <username>"
+
+// runUnlock forgets failed logins of username, so it can log in again before its lock expires
+func runUnlock(cfg config.Config, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf(unlockUsage)
+	}
+	if isMemoryDSN(cfg.DSN) {
+		return fmt.Errorf("in memory store is not shared with running server, restart it instead")
+	}
+	store, err := openSQLStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.ResetLoginAttempts(context.Background(), args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "unlocked %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,445 @@
+// Package config loads application configuration from a file, environment variables and command line flags
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prefix of all environment variables read by config
+const EnvPrefix = "BLOG_"
+
+const redactedValue = "REDACTED"
+
+// DefaultDSN is connection string of local Postgres used when dsn is not configured
+const DefaultDSN = "user=postgres password=postgres dbname=postgres sslmode=disable"
+
+// DefaultJWTSecret is built-in secret to sign auth tokens. It is public, so it is accepted only in dev and test environments
+const DefaultJWTSecret = "qweasdzxc"
+
+// Supported environments
+const (
+	EnvironmentDev  = "dev"
+	EnvironmentTest = "test"
+	EnvironmentProd = "prod"
+)
+
+// Supported log levels
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Config is application configuration
+type Config struct {
+	Environment  string            `json:"environment"`
+	DSN          string            `json:"dsn"`
+	AutoMigrate  bool              `json:"auto_migrate"`
+	MaxTxRetries int               `json:"max_tx_retries"`
+	Addr         string            `json:"addr"`
+	JWT          JWTConfig         `json:"jwt"`
+	CORS         CORSConfig        `json:"cors"`
+	RateLimits   RateLimitsConfig  `json:"rate_limits"`
+	Lockout      LockoutConfig     `json:"lockout"`
+	Cache        CacheConfig       `json:"cache"`
+	Compression  CompressionConfig `json:"compression"`
+	Timeouts     TimeoutsConfig    `json:"timeouts"`
+	LogLevel     string            `json:"log_level"`
+}
+
+// JWTConfig is auth token configuration
+type JWTConfig struct {
+	Secret string   `json:"secret"`
+	TTL    Duration `json:"ttl"`
+}
+
+// CORSConfig is cross-origin resource sharing configuration
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           Duration `json:"max_age"`
+}
+
+// RateLimitsConfig is request rate limits configuration
+type RateLimitsConfig struct {
+	Auth  RateLimitConfig `json:"auth"`
+	Write RateLimitConfig `json:"write"`
+	// TrustedProxies are ips and CIDR networks of reverse proxies whose forwarding headers carry client ip
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// RateLimitConfig allows burst of Requests which are restored evenly during Period. Zero Requests disables the limit
+type RateLimitConfig struct {
+	Requests int      `json:"requests"`
+	Period   Duration `json:"period"`
+}
+
+// LockoutConfig is configuration of temporary lock of usernames after failed logins. Zero MaxFailures disables lockout
+type LockoutConfig struct {
+	MaxFailures int      `json:"max_failures"`
+	Duration    Duration `json:"duration"`
+	MaxDuration Duration `json:"max_duration"`
+}
+
+// CacheConfig is configuration of store cache of articles and users. Zero Size disables the cache
+type CacheConfig struct {
+	Size int      `json:"size"`
+	TTL  Duration `json:"ttl"`
+}
+
+// CompressionConfig is configuration of gzip compression of responses
+type CompressionConfig struct {
+	Enabled bool `json:"enabled"`
+	MinSize int  `json:"min_size"`
+}
+
+// TimeoutsConfig is http server timeouts configuration
+type TimeoutsConfig struct {
+	Read       Duration `json:"read"`
+	Write      Duration `json:"write"`
+	Idle       Duration `json:"idle"`
+	DrainDelay Duration `json:"drain_delay"`
+	Shutdown   Duration `json:"shutdown"`
+	Query      Duration `json:"query"`
+}
+
+// Duration is time.Duration which is represented as "1m30s" string in json
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) (e error) {
+	var s string
+	if e = json.Unmarshal(b, &s); e != nil {
+		return fmt.Errorf("duration must be a string like \"1m30s\": %v", e)
+	}
+	d.Duration, e = time.ParseDuration(s)
+	return
+}
+
+// Default returns config with default values
+func Default() Config {
+	return Config{
+		Environment:  EnvironmentProd,
+		DSN:          DefaultDSN,
+		MaxTxRetries: 5,
+		Addr:         ":3000",
+		JWT: JWTConfig{
+			Secret: DefaultJWTSecret,
+			TTL:    Duration{30 * time.Minute},
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type"},
+		},
+		RateLimits: RateLimitsConfig{
+			Auth:  RateLimitConfig{Requests: 10, Period: Duration{time.Minute}},
+			Write: RateLimitConfig{Requests: 60, Period: Duration{time.Minute}},
+		},
+		Lockout: LockoutConfig{
+			MaxFailures: 5,
+			Duration:    Duration{time.Minute},
+			MaxDuration: Duration{time.Hour},
+		},
+		Cache: CacheConfig{
+			TTL: Duration{time.Minute},
+		},
+		Compression: CompressionConfig{
+			Enabled: true,
+			MinSize: 1024,
+		},
+		Timeouts: TimeoutsConfig{
+			Read:     Duration{5 * time.Second},
+			Write:    Duration{10 * time.Second},
+			Idle:     Duration{60 * time.Second},
+			Shutdown: Duration{15 * time.Second},
+			Query:    Duration{5 * time.Second},
+		},
+		LogLevel: LogLevelInfo,
+	}
+}
+
+type setting struct {
+	name  string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func settings() []setting {
+	return []setting{
+		{"environment", "one of dev, test, prod. Built-in jwt secret is accepted only in dev and test", setString(func(c *Config) *string { return &c.Environment })},
+		{"dsn", "database connection string", setString(func(c *Config) *string { return &c.DSN })},
+		{"auto-migrate", "apply pending db migrations at startup", setBool(func(c *Config) *bool { return &c.AutoMigrate })},
+		{"max-tx-retries", "times db transaction is retried after it conflicts with concurrent ones", setInt(func(c *Config) *int { return &c.MaxTxRetries })},
+		{"addr", "address to listen on", setString(func(c *Config) *string { return &c.Addr })},
+		{"jwt-secret", "secret key to sign auth tokens", setString(func(c *Config) *string { return &c.JWT.Secret })},
+		{"jwt-ttl", "auth token lifetime", setDuration(func(c *Config) *Duration { return &c.JWT.TTL })},
+		{"cors-allowed-origins", "comma separated list of origins allowed to make cross-origin requests", setList(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+		{"cors-allowed-methods", "comma separated list of methods allowed for cross-origin requests", setList(func(c *Config) *[]string { return &c.CORS.AllowedMethods })},
+		{"cors-allowed-headers", "comma separated list of headers allowed for cross-origin requests", setList(func(c *Config) *[]string { return &c.CORS.AllowedHeaders })},
+		{"cors-allow-credentials", "allow cross-origin requests with credentials", setBool(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+		{"cors-max-age", "how long preflight responses can be cached", setDuration(func(c *Config) *Duration { return &c.CORS.MaxAge })},
+		{"auth-rate-limit", "login and registration attempts allowed per client ip and per username during auth rate period, 0 disables the limit", setInt(func(c *Config) *int { return &c.RateLimits.Auth.Requests })},
+		{"auth-rate-period", "period to restore auth rate limit", setDuration(func(c *Config) *Duration { return &c.RateLimits.Auth.Period })},
+		{"write-rate-limit", "write requests allowed per user during write rate period, 0 disables the limit", setInt(func(c *Config) *int { return &c.RateLimits.Write.Requests })},
+		{"write-rate-period", "period to restore write rate limit", setDuration(func(c *Config) *Duration { return &c.RateLimits.Write.Period })},
+		{"trusted-proxies", "comma separated list of proxy ips and CIDR networks allowed to pass client ip in X-Forwarded-For and X-Real-IP headers", setList(func(c *Config) *[]string { return &c.RateLimits.TrustedProxies })},
+		{"lockout-max-failures", "failed logins in a row which lock username, 0 disables lockout", setInt(func(c *Config) *int { return &c.Lockout.MaxFailures })},
+		{"lockout-duration", "how long username is locked, every next failure doubles it", setDuration(func(c *Config) *Duration { return &c.Lockout.Duration })},
+		{"lockout-max-duration", "maximum time username can be locked for", setDuration(func(c *Config) *Duration { return &c.Lockout.MaxDuration })},
+		{"cache-size", "maximum number of cached articles and of cached users, 0 disables the cache", setInt(func(c *Config) *int { return &c.Cache.Size })},
+		{"cache-ttl", "how long articles and users are cached", setDuration(func(c *Config) *Duration { return &c.Cache.TTL })},
+		{"compression", "compress responses with gzip for clients which accept it", setBool(func(c *Config) *bool { return &c.Compression.Enabled })},
+		{"compression-min-size", "minimum response size in bytes to compress", setInt(func(c *Config) *int { return &c.Compression.MinSize })},
+		{"read-timeout", "maximum duration for reading the entire request", setDuration(func(c *Config) *Duration { return &c.Timeouts.Read })},
+		{"write-timeout", "maximum duration before timing out writes of the response", setDuration(func(c *Config) *Duration { return &c.Timeouts.Write })},
+		{"idle-timeout", "maximum time to wait for the next request on keep-alive connections", setDuration(func(c *Config) *Duration { return &c.Timeouts.Idle })},
+		{"drain-delay", "time to keep serving with failing readiness probe before shutdown starts", setDuration(func(c *Config) *Duration { return &c.Timeouts.DrainDelay })},
+		{"shutdown-timeout", "maximum time to wait for in-flight requests on shutdown", setDuration(func(c *Config) *Duration { return &c.Timeouts.Shutdown })},
+		{"query-timeout", "maximum duration of a single db query", setDuration(func(c *Config) *Duration { return &c.Timeouts.Query })},
+		{"log-level", "one of debug, info, warn, error", setString(func(c *Config) *string { return &c.LogLevel })},
+	}
+}
+
+// Load builds config from defaults, json file, environment variables and command line args in increasing precedence.
+// Config file path is taken from -config flag or BLOG_CONFIG environment variable.
+// Caller can register additional flags in fs before Load is called
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	c := Default()
+	configPath := fs.String("config", "", "path to json config file")
+	byName := map[string]setting{}
+	flagValues := map[string]*string{}
+	for _, s := range settings() {
+		byName[s.name] = s
+		flagValues[s.name] = fs.String(s.name, "", s.usage)
+	}
+	if e := fs.Parse(args); e != nil {
+		return c, e
+	}
+
+	if *configPath == "" {
+		*configPath, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if *configPath != "" {
+		if e := loadFile(&c, *configPath); e != nil {
+			return c, e
+		}
+	}
+
+	for _, s := range settings() {
+		if v, ok := lookupEnv(envName(s.name)); ok {
+			if e := s.set(&c, v); e != nil {
+				return c, fmt.Errorf("invalid value of %s environment variable: %v", envName(s.name), e)
+			}
+		}
+	}
+
+	var e error
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := byName[f.Name]; ok && e == nil {
+			if err := s.set(&c, *flagValues[f.Name]); err != nil {
+				e = fmt.Errorf("invalid value of -%s flag: %v", f.Name, err)
+			}
+		}
+	})
+	if e != nil {
+		return c, e
+	}
+	return c, c.Validate()
+}
+
+// Validate checks that config values are consistent
+func (c Config) Validate() error {
+	errors := []string{}
+	switch c.Environment {
+	case EnvironmentDev, EnvironmentTest:
+	case EnvironmentProd:
+		if c.JWT.Secret == DefaultJWTSecret {
+			errors = append(errors, "jwt secret must be changed from the built-in one outside dev and test environments")
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("unknown environment %q", c.Environment))
+	}
+	if c.DSN == "" {
+		errors = append(errors, "dsn must not be empty")
+	}
+	if c.MaxTxRetries <= 0 {
+		errors = append(errors, "max tx retries must be positive")
+	}
+	if c.Addr == "" {
+		errors = append(errors, "addr must not be empty")
+	}
+	if c.JWT.Secret == "" {
+		errors = append(errors, "jwt secret must not be empty")
+	}
+	if c.JWT.TTL.Duration <= 0 {
+		errors = append(errors, "jwt ttl must be positive")
+	}
+	if c.CORS.MaxAge.Duration < 0 {
+		errors = append(errors, "cors max age must not be negative")
+	}
+	rateLimits := []struct {
+		name  string
+		limit RateLimitConfig
+	}{
+		{"auth", c.RateLimits.Auth},
+		{"write", c.RateLimits.Write},
+	}
+	for _, l := range rateLimits {
+		if l.limit.Requests < 0 {
+			errors = append(errors, fmt.Sprintf("%s rate limit must not be negative", l.name))
+		}
+		if l.limit.Requests > 0 && l.limit.Period.Duration <= 0 {
+			errors = append(errors, fmt.Sprintf("%s rate period must be positive", l.name))
+		}
+	}
+	for _, p := range c.RateLimits.TrustedProxies {
+		if _, _, e := net.ParseCIDR(p); e != nil && net.ParseIP(p) == nil {
+			errors = append(errors, fmt.Sprintf("trusted proxy %q must be ip or CIDR network", p))
+		}
+	}
+	if c.Lockout.MaxFailures < 0 {
+		errors = append(errors, "lockout max failures must not be negative")
+	}
+	if c.Lockout.MaxFailures > 0 && c.Lockout.Duration.Duration <= 0 {
+		errors = append(errors, "lockout duration must be positive")
+	}
+	if c.Lockout.MaxDuration.Duration < c.Lockout.Duration.Duration {
+		errors = append(errors, "lockout max duration must not be less than lockout duration")
+	}
+	if c.Cache.Size < 0 {
+		errors = append(errors, "cache size must not be negative")
+	}
+	if c.Cache.Size > 0 && c.Cache.TTL.Duration <= 0 {
+		errors = append(errors, "cache ttl must be positive")
+	}
+	if c.Compression.MinSize < 0 {
+		errors = append(errors, "compression min size must not be negative")
+	}
+	timeouts := []struct {
+		name string
+		d    Duration
+	}{
+		{"read", c.Timeouts.Read},
+		{"write", c.Timeouts.Write},
+		{"idle", c.Timeouts.Idle},
+		{"drain delay", c.Timeouts.DrainDelay},
+		{"shutdown", c.Timeouts.Shutdown},
+		{"query", c.Timeouts.Query},
+	}
+	for _, t := range timeouts {
+		if t.d.Duration < 0 {
+			errors = append(errors, fmt.Sprintf("%s timeout must not be negative", t.name))
+		}
+	}
+	switch c.LogLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		errors = append(errors, fmt.Sprintf("unknown log level %q", c.LogLevel))
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// Redacted returns copy of config with secrets hidden
+func (c Config) Redacted() Config {
+	c.DSN = redactDSN(c.DSN)
+	if c.JWT.Secret != "" {
+		c.JWT.Secret = redactedValue
+	}
+	return c
+}
+
+// String returns json representation of redacted config
+func (c Config) String() string {
+	b, _ := json.MarshalIndent(c.Redacted(), "", "  ")
+	return string(b)
+}
+
+var dsnPasswordRegexp = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func redactDSN(dsn string) string {
+	if u, e := url.Parse(dsn); e == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+			return u.String()
+		}
+	}
+	return dsnPasswordRegexp.ReplaceAllString(dsn, "${1}"+redactedValue)
+}
+
+func loadFile(c *Config, path string) error {
+	b, e := ioutil.ReadFile(path)
+	if e != nil {
+		return fmt.Errorf("could not read config file: %v", e)
+	}
+	if e = json.Unmarshal(b, c); e != nil {
+		return fmt.Errorf("could not parse config file %q: %v", path, e)
+	}
+	return nil
+}
+
+func envName(setting string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(setting, "-", "_", -1))
+}
+
+func setString(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func setDuration(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) (e error) {
+		field(c).Duration, e = time.ParseDuration(v)
+		return
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) (e error) {
+		*field(c), e = strconv.Atoi(v)
+		return
+	}
+}
+
+func setBool(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) (e error) {
+		*field(c), e = strconv.ParseBool(v)
+		return
+	}
+}
+
+func setList(field func(c *Config) *[]string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		list := []string{}
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
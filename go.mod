@@ -1,12 +1,13 @@
 module github.com/trapck/go-rest-api
 
-go 1.14
+go 1.16
 
 require (
 	github.com/auth0/go-jwt-middleware v0.0.0-20200507191422-d30d7b9ece63
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/lib/pq v1.7.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/rs/cors v1.7.0
 	github.com/stretchr/testify v1.6.1
 )
@@ -1,8 +1,101 @@
 package server
 
-import "strings"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode"
+)
 
-// CreateSlug creates slug from title
+// Slug limits
+const (
+	maxSlugLength       = 80
+	slugNumericAttempts = 5
+	maxSlugAttempts     = 10
+	slugRandomBytes     = 3
+	defaultSlug         = "article"
+)
+
+// reservedSlugs are names of routes under ArticlesPath which articles can't take
+var reservedSlugs = map[string]bool{
+	strings.TrimPrefix(ArticleSearchPath, ArticlesPath): true,
+}
+
+// CreateSlug creates url safe slug from title. Letters are transliterated to ascii, other symbols become separators
 func CreateSlug(title string) string {
-	return strings.ToLower(strings.Join(strings.Fields(title), "-"))
+	var b strings.Builder
+	pendingSeparator := false
+	for _, r := range strings.ToLower(title) {
+		part, ok := transliterate(r)
+		if !ok {
+			pendingSeparator = b.Len() > 0
+			continue
+		}
+		if pendingSeparator {
+			b.WriteByte('-')
+			pendingSeparator = false
+		}
+		b.WriteString(part)
+	}
+	slug := truncateSlug(b.String(), maxSlugLength)
+	if slug == "" {
+		return defaultSlug
+	}
+	if reservedSlugs[slug] {
+		return slug + "-" + defaultSlug
+	}
+	return slug
+}
+
+// slugCandidate returns slug to try on given attempt of unique slug creation.
+// First attempt is the slug itself, then numeric suffixes are tried and then random ones
+func slugCandidate(slug string, attempt int) string {
+	if attempt == 0 {
+		return slug
+	}
+	suffix := strconv.Itoa(attempt + 1)
+	if attempt >= slugNumericAttempts {
+		suffix = randomSlugSuffix()
+	}
+	return truncateSlug(slug, maxSlugLength-len(suffix)-1) + "-" + suffix
+}
+
+// truncateSlug cuts slug to max length preferring word boundary
+func truncateSlug(slug string, max int) string {
+	if len(slug) <= max {
+		return slug
+	}
+	slug = slug[:max]
+	if i := strings.LastIndexByte(slug, '-'); i > max/2 {
+		slug = slug[:i]
+	}
+	return strings.Trim(slug, "-")
+}
+
+func randomSlugSuffix() string {
+	b := make([]byte, slugRandomBytes)
+	if _, e := rand.Read(b); e != nil {
+		panic(e)
+	}
+	return hex.EncodeToString(b)
+}
+
+// transliterate returns ascii representation of lower case rune. It reports false if rune is not a known letter or digit
+func transliterate(r rune) (string, bool) {
+	switch {
+	case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		return string(r), true
+	case r <= unicode.MaxASCII:
+		return "", false
+	}
+	s, ok := transliterations[r]
+	return s, ok
+}
+
+// reverseArticles reverses order of articles in place
+func reverseArticles(articles []Article) {
+	for i, j := 0, len(articles)-1; i < j; i, j = i+1, j-1 {
+		articles[i], articles[j] = articles[j], articles[i]
+	}
 }
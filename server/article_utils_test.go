@@ -1,6 +1,8 @@
 package server
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,14 +10,49 @@ import (
 
 func TestCreateSlug(t *testing.T) {
 	testCases := map[string]string{
-		"test":                 "test",
-		"test article":         "test-article",
-		"   test":              "test",
-		"test    ":             "test",
-		"   test   article   ": "test-article",
-		"TEST ARTICLE":         "test-article",
+		"test":                       "test",
+		"test article":               "test-article",
+		"   test":                    "test",
+		"test    ":                   "test",
+		"   test   article   ":       "test-article",
+		"TEST ARTICLE":               "test-article",
+		"Hello, world!":              "hello-world",
+		"  --Go 1.16: what's new?--": "go-1-16-what-s-new",
+		"Привет, мир!":               "privet-mir",
+		"Объявление":                 "obyavlenie",
+		"Crème brûlée":               "creme-brulee",
+		"Straße":                     "strasse",
+		"!!!":                        defaultSlug,
+		"日本語":                        defaultSlug,
+		"Search":                     "search-article",
 	}
 	for title, slug := range testCases {
-		assert.Equal(t, slug, CreateSlug(title))
+		assert.Equal(t, slug, CreateSlug(title), "unexpected slug for title %q", title)
 	}
+
+	t.Run("should cap slug length on word boundary", func(t *testing.T) {
+		slug := CreateSlug(strings.Repeat("word ", maxSlugLength))
+		assert.LessOrEqual(t, len(slug), maxSlugLength)
+		assert.True(t, strings.HasSuffix(slug, "word"), "expected slug to end with whole word but got %q", slug)
+	})
+}
+
+func TestSlugCandidate(t *testing.T) {
+	t.Run("should try slug itself and then numeric suffixes", func(t *testing.T) {
+		assert.Equal(t, "title", slugCandidate("title", 0))
+		assert.Equal(t, "title-2", slugCandidate("title", 1))
+		assert.Equal(t, fmt.Sprintf("title-%d", slugNumericAttempts), slugCandidate("title", slugNumericAttempts-1))
+	})
+
+	t.Run("should switch to random suffixes", func(t *testing.T) {
+		candidate := slugCandidate("title", slugNumericAttempts)
+		assert.Regexp(t, "^title-[0-9a-f]{6}$", candidate)
+		assert.NotEqual(t, candidate, slugCandidate("title", slugNumericAttempts))
+	})
+
+	t.Run("should keep slug with suffix within max length", func(t *testing.T) {
+		long := strings.Repeat("a", maxSlugLength)
+		assert.LessOrEqual(t, len(slugCandidate(long, 1)), maxSlugLength)
+		assert.LessOrEqual(t, len(slugCandidate(long, maxSlugAttempts-1)), maxSlugLength)
+	})
 }
@@ -10,6 +10,17 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+var (
+	authSecretKey = "qweasdzxc"
+	authTokenTTL  = 30 * time.Minute
+)
+
+// ConfigureAuth sets secret key and lifetime of auth tokens. Must be called before server starts
+func ConfigureAuth(secret string, ttl time.Duration) {
+	authSecretKey = secret
+	authTokenTTL = ttl
+}
+
 // ApplyAuth applies midleware to check authorization by jwt
 func ApplyAuth(next http.Handler) http.Handler {
 	return jwtmiddleware.New(jwtmiddleware.Options{
@@ -26,7 +37,7 @@ func CreateToken(d AuthData) string {
 	t, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, AuthClaims{
 		User: d,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(30 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(authTokenTTL).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 	}).SignedString([]byte(authSecretKey))
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,3 +44,20 @@ func TestTokenFromAuthHeader(t *testing.T) {
 	assert.NoError(t, e, "expected to get no error for empty auth header")
 	assert.Empty(t, h, "expected to get empty token from empty auth header")
 }
+
+func TestConfigureAuth(t *testing.T) {
+	defer ConfigureAuth(authSecretKey, authTokenTTL)
+	u := AuthData{"user1"}
+	oldToken := CreateToken(u)
+
+	ConfigureAuth("new secret", time.Minute)
+	_, err := ParseToken(oldToken)
+	assert.Error(t, err, "expected token signed with previous secret to be rejected")
+
+	claims := AuthClaims{}
+	_, err = jwt.ParseWithClaims(CreateToken(u), &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("new secret"), nil
+	})
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected token to be signed with configured secret but got %q", err))
+	assert.Equal(t, int64(time.Minute.Seconds()), claims.ExpiresAt-claims.IssuedAt, "expected token to have configured lifetime")
+}
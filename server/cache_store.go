@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures CachingBlogStore. Size is maximum number of cached articles and of cached users
+type CacheOptions struct {
+	Size int
+	TTL  time.Duration
+}
+
+// CacheCounters are usage counters of a cache
+type CacheCounters struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// CacheStats is usage of CachingBlogStore caches
+type CacheStats struct {
+	Articles CacheCounters
+	Users    CacheCounters
+}
+
+// CachingBlogStore is BlogStore decorator which caches articles by slug and users by username.
+// Articles include author profile, so they are invalidated on changes of their author as well.
+// Operations inside transactions bypass cache and invalidate it when transaction finishes
+type CachingBlogStore struct {
+	BlogStore
+	articles *lruCache
+	users    *lruCache
+}
+
+// NewCachingBlogStore wraps store with read-through cache
+func NewCachingBlogStore(store BlogStore, o CacheOptions) *CachingBlogStore {
+	return &CachingBlogStore{BlogStore: store, articles: newLRUCache(o.Size, o.TTL), users: newLRUCache(o.Size, o.TTL)}
+}
+
+// GetArticle returns cached article or reads it from store
+func (s *CachingBlogStore) GetArticle(ctx context.Context, slug string) (Article, error) {
+	v, generation, ok := s.articles.get(slug)
+	if ok {
+		return v.(Article), nil
+	}
+	a, err := s.BlogStore.GetArticle(ctx, slug)
+	if err == nil {
+		s.articles.set(slug, a, generation)
+	}
+	return a, err
+}
+
+// UpdateArticle updates article in store and removes it from cache
+func (s *CachingBlogStore) UpdateArticle(ctx context.Context, a Article) (Article, error) {
+	defer s.invalidateArticle(a.ID)
+	return s.BlogStore.UpdateArticle(ctx, a)
+}
+
+// GetUser returns cached user or reads it from store
+func (s *CachingBlogStore) GetUser(ctx context.Context, username string) (RequestUserData, error) {
+	v, generation, ok := s.users.get(username)
+	if ok {
+		return v.(RequestUserData), nil
+	}
+	u, err := s.BlogStore.GetUser(ctx, username)
+	if err == nil {
+		s.users.set(username, u, generation)
+	}
+	return u, err
+}
+
+// UpdateUser updates user in store and removes the user and articles of the user from cache
+func (s *CachingBlogStore) UpdateUser(ctx context.Context, username string, data RequestUserData) (RequestUserData, error) {
+	u, err := s.BlogStore.UpdateUser(ctx, username, data)
+	s.invalidateUser(u.ID, username, data.UserName)
+	return u, err
+}
+
+// InTx runs f with store transaction. Changes made by f are removed from cache after transaction finishes
+func (s *CachingBlogStore) InTx(ctx context.Context, f func(tx BlogStore) error) error {
+	tx := &cachingTx{cache: s, pending: &pendingInvalidations{}}
+	defer tx.pending.apply()
+	return s.BlogStore.InTx(ctx, func(storeTx BlogStore) error {
+		tx.BlogStore = storeTx
+		return f(tx)
+	})
+}
+
+// Stats returns usage counters of caches
+func (s *CachingBlogStore) Stats() CacheStats {
+	return CacheStats{Articles: s.articles.stats(), Users: s.users.stats()}
+}
+
+// Ping checks decorated store if it is able to report readiness
+func (s *CachingBlogStore) Ping(ctx context.Context) error {
+	if checker, ok := s.BlogStore.(ReadinessChecker); ok {
+		return checker.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes decorated store if it needs closing
+func (s *CachingBlogStore) Close() error {
+	if c, ok := s.BlogStore.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *CachingBlogStore) invalidateArticle(id int) {
+	s.articles.removeIf(func(v interface{}) bool { return v.(Article).ID == id })
+}
+
+func (s *CachingBlogStore) invalidateUser(id int, usernames ...string) {
+	s.users.remove(usernames...)
+	if id != 0 {
+		s.articles.removeIf(func(v interface{}) bool {
+			a := v.(Article)
+			return a.AuthorID.Valid && int(a.AuthorID.Int32) == id
+		})
+	}
+}
+
+// cachingTx is store transaction which records changes to remove from cache when transaction finishes
+type cachingTx struct {
+	BlogStore
+	cache   *CachingBlogStore
+	pending *pendingInvalidations
+}
+
+// pendingInvalidations are cache removals to apply when the outermost transaction finishes
+type pendingInvalidations struct {
+	mu sync.Mutex
+	fs []func()
+}
+
+func (tx *cachingTx) UpdateArticle(ctx context.Context, a Article) (Article, error) {
+	tx.pending.add(func() { tx.cache.invalidateArticle(a.ID) })
+	return tx.BlogStore.UpdateArticle(ctx, a)
+}
+
+func (tx *cachingTx) UpdateUser(ctx context.Context, username string, data RequestUserData) (RequestUserData, error) {
+	u, err := tx.BlogStore.UpdateUser(ctx, username, data)
+	tx.pending.add(func() { tx.cache.invalidateUser(u.ID, username, data.UserName) })
+	return u, err
+}
+
+func (tx *cachingTx) InTx(ctx context.Context, f func(tx BlogStore) error) error {
+	return tx.BlogStore.InTx(ctx, func(storeTx BlogStore) error {
+		return f(&cachingTx{BlogStore: storeTx, cache: tx.cache, pending: tx.pending})
+	})
+}
+
+func (p *pendingInvalidations) add(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fs = append(p.fs, f)
+}
+
+func (p *pendingInvalidations) apply() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, f := range p.fs {
+		f()
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// CountingBlogStore counts reads which reach the decorated store
+type CountingBlogStore struct {
+	BlogStore
+	articleReads int
+	userReads    int
+}
+
+func (s *CountingBlogStore) GetArticle(ctx context.Context, slug string) (Article, error) {
+	s.articleReads++
+	return s.BlogStore.GetArticle(ctx, slug)
+}
+
+func (s *CountingBlogStore) GetUser(ctx context.Context, username string) (RequestUserData, error) {
+	s.userReads++
+	return s.BlogStore.GetUser(ctx, username)
+}
+
+func TestCachingBlogStore(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(t *testing.T) (*CachingBlogStore, *CountingBlogStore, RequestUserData, Article) {
+		memory := NewInMemoryBlogStore()
+		author, _ := memory.Registration(ctx, RequestUserData{CommonUserData: CommonUserData{UserName: "author"}})
+		a, err := memory.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: "cached", AuthorID: sql.NullInt32{Int32: int32(author.ID), Valid: true}}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("could not create test article. %q", err))
+		counting := &CountingBlogStore{BlogStore: memory}
+		return NewCachingBlogStore(counting, CacheOptions{Size: 2, TTL: time.Minute}), counting, author, a
+	}
+
+	t.Run("should read article from store once", func(t *testing.T) {
+		store, counting, _, a := newStore(t)
+		for i := 0; i < 3; i++ {
+			found, err := store.GetArticle(ctx, a.Slug)
+			assert.NoError(t, err)
+			assert.Equal(t, a, found)
+		}
+		assert.Equal(t, 1, counting.articleReads)
+		assert.Equal(t, CacheCounters{Hits: 2, Misses: 1, Size: 1}, store.Stats().Articles)
+	})
+
+	t.Run("should not cache missing articles", func(t *testing.T) {
+		store, counting, _, _ := newStore(t)
+		store.GetArticle(ctx, "missing")
+		_, err := store.GetArticle(ctx, "missing")
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound but got %v", err)
+		assert.Equal(t, 2, counting.articleReads)
+	})
+
+	t.Run("should invalidate article updated in transaction by all its slugs", func(t *testing.T) {
+		store, _, _, a := newStore(t)
+		store.GetArticle(ctx, a.Slug)
+		err := store.InTx(ctx, func(tx BlogStore) error {
+			a.Title = "renamed"
+			_, err := tx.UpdateArticle(ctx, a)
+			return err
+		})
+		assert.NoError(t, err)
+		found, _ := store.GetArticle(ctx, a.Slug)
+		assert.Equal(t, "renamed", found.Title)
+	})
+
+	t.Run("should invalidate user and articles of the user on user update", func(t *testing.T) {
+		store, _, author, a := newStore(t)
+		store.GetArticle(ctx, a.Slug)
+		store.GetUser(ctx, author.UserName)
+		renamed := author
+		renamed.UserName = "renamed author"
+		_, err := store.UpdateUser(ctx, author.UserName, renamed)
+		assert.NoError(t, err)
+
+		_, err = store.GetUser(ctx, author.UserName)
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound for previous username but got %v", err)
+		found, _ := store.GetArticle(ctx, a.Slug)
+		assert.Equal(t, renamed.UserName, found.Author.UserName)
+	})
+
+	t.Run("should evict least recently used entries", func(t *testing.T) {
+		store, counting, _, a := newStore(t)
+		for _, title := range []string{"second", "third"} {
+			store.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: title}})
+		}
+		store.GetArticle(ctx, a.Slug)
+		store.GetArticle(ctx, "second")
+		store.GetArticle(ctx, a.Slug)
+		store.GetArticle(ctx, "third")
+		store.GetArticle(ctx, a.Slug)
+		assert.Equal(t, 3, counting.articleReads, "expected recently used article to stay in cache")
+		store.GetArticle(ctx, "second")
+		assert.Equal(t, 4, counting.articleReads, "expected least recently used article to be evicted")
+		assert.Equal(t, uint64(2), store.Stats().Articles.Evictions)
+	})
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Now()
+	c := newLRUCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	t.Run("should expire entries after ttl", func(t *testing.T) {
+		_, generation, _ := c.get("key")
+		c.set("key", 1, generation)
+		now = now.Add(time.Minute)
+		_, _, ok := c.get("key")
+		assert.False(t, ok)
+	})
+
+	t.Run("should not cache values loaded before removal", func(t *testing.T) {
+		_, generation, _ := c.get("key")
+		c.remove("other key")
+		c.set("key", 1, generation)
+		_, _, ok := c.get("key")
+		assert.False(t, ok)
+	})
+}
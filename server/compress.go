@@ -0,0 +1,203 @@
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressionOptions configures gzip compression of responses. Responses shorter than MinSize bytes are sent as is
+type CompressionOptions struct {
+	MinSize int
+}
+
+// encodingGzip is the only supported content coding
+const encodingGzip = "gzip"
+
+// gzipETagSuffix marks ETag of gzip encoded representation, which must differ from ETag of identity one
+const gzipETagSuffix = "-gzip"
+
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// WithCompression enables gzip compression of responses for clients which accept it
+func WithCompression(o CompressionOptions) ServerOption {
+	return func(s *serverOptions) {
+		s.compression = &o
+	}
+}
+
+// applyCompression wraps handler with gzip compression negotiated by Accept-Encoding.
+// Response is buffered until MinSize bytes are written, so short responses are sent without compression.
+// ETags of compressed responses get gzip suffix which is removed from conditional request headers before handler sees them
+func applyCompression(o CompressionOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add(HeaderKeyVary, HeaderKeyAcceptEncoding)
+		if !acceptsGzip(r.Header.Get(HeaderKeyAcceptEncoding)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, minSize: o.MinSize, ifNoneMatch: r.Header.Get(HeaderKeyIfNoneMatch)}
+		defer cw.Close()
+		next.ServeHTTP(cw, withoutGzipETags(r))
+	})
+}
+
+// acceptsGzip reports if Accept-Encoding header value allows gzip coding
+func acceptsGzip(header string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, coding := range strings.Split(header, ",") {
+		parts := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, e := strconv.ParseFloat(param[2:], 64)
+				if e != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		switch name {
+		case encodingGzip, "x-gzip":
+			gzipQ = q
+		case "*":
+			anyQ = q
+		}
+	}
+	return gzipQ > 0 || (gzipQ < 0 && anyQ > 0)
+}
+
+// withoutGzipETags returns request with ETags of gzip representations in conditional headers replaced by the original ones
+func withoutGzipETags(r *http.Request) *http.Request {
+	var changed *http.Request
+	for _, key := range []string{HeaderKeyIfNoneMatch, HeaderKeyIfMatch} {
+		v := r.Header.Get(key)
+		if !strings.Contains(v, gzipETagSuffix+`"`) {
+			continue
+		}
+		if changed == nil {
+			changed = r.Clone(r.Context())
+		}
+		changed.Header.Set(key, strings.ReplaceAll(v, gzipETagSuffix+`"`, `"`))
+	}
+	if changed == nil {
+		return r
+	}
+	return changed
+}
+
+// gzipETag returns ETag of gzip representation of resource with the etag
+func gzipETag(etag string) string {
+	return strings.TrimSuffix(etag, `"`) + gzipETagSuffix + `"`
+}
+
+// compressWriter buffers response until it is long enough to compress or handler finishes
+type compressWriter struct {
+	http.ResponseWriter
+	minSize     int
+	ifNoneMatch string
+	status      int
+	buf         []byte
+	started     bool
+	gz          *gzip.Writer
+}
+
+// WriteHeader postpones status until it is known if response is compressed
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	if cw.started {
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		if e := cw.start(true); e != nil {
+			return 0, e
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends buffered response. It is compressed regardless of its size since streamed response is expected to be long
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(len(cw.buf) > 0)
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends rest of the response and releases gzip writer
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		if e := cw.start(len(cw.buf) > 0 && len(cw.buf) >= cw.minSize); e != nil {
+			return e
+		}
+	}
+	if cw.gz == nil {
+		return nil
+	}
+	e := cw.gz.Close()
+	gzipWriters.Put(cw.gz)
+	cw.gz = nil
+	return e
+}
+
+// start writes headers and buffered body, compressing it if compress is set and response allows it
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	h := cw.Header()
+	etag := h.Get(HeaderKeyETag)
+	if compress && cw.canCompress() {
+		h.Set(HeaderKeyContentEncoding, encodingGzip)
+		h.Del(HeaderKeyContentLength)
+		if etag != "" {
+			h.Set(HeaderKeyETag, gzipETag(etag))
+		}
+		cw.gz = gzipWriters.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	} else if cw.status == http.StatusNotModified && etag != "" && strings.Contains(cw.ifNoneMatch, gzipETag(etag)) {
+		h.Set(HeaderKeyETag, gzipETag(etag))
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.gz != nil {
+		_, e := cw.gz.Write(buf)
+		return e
+	}
+	_, e := cw.ResponseWriter.Write(buf)
+	return e
+}
+
+// canCompress reports if response has body which is not encoded yet
+func (cw *compressWriter) canCompress() bool {
+	if cw.status < http.StatusOK || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	return cw.Header().Get(HeaderKeyContentEncoding) == ""
+}
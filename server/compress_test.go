@@ -0,0 +1,107 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	testCases := map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"deflate, GZIP;q=0.5":   true,
+		"br, x-gzip":            true,
+		"*":                     true,
+		"gzip;q=0":              false,
+		"gzip;q=0, *":           false,
+		"*;q=0":                 false,
+		"deflate, identity":     false,
+		"gzip;q=invalid, *;q=1": false,
+	}
+	for header, expected := range testCases {
+		assert.Equal(t, expected, acceptsGzip(header), "for Accept-Encoding %q", header)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	for i := 0; i < 10; i++ {
+		store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: fmt.Sprintf("article %d", i), Body: strings.Repeat("long body ", 150)}})
+	}
+	a, _ := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "short"}})
+	server := newContractServer(t, store, WithCompression(CompressionOptions{MinSize: 1024}))
+	serve := func(req *http.Request, acceptEncoding string) *httptest.ResponseRecorder {
+		if acceptEncoding != "" {
+			req.Header.Set(HeaderKeyAcceptEncoding, acceptEncoding)
+		}
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("should compress long response for client accepting gzip", func(t *testing.T) {
+		req, _ := makeListArticlesRequestSuite(url.Values{})
+		resp := serve(req, "gzip")
+		assertStatus(t, http.StatusOK, resp.Code, "for compressed list")
+		assert.Equal(t, encodingGzip, resp.Header().Get(HeaderKeyContentEncoding))
+		assert.Equal(t, HeaderKeyAcceptEncoding, resp.Header().Get(HeaderKeyVary))
+		assertJSONContentType(t, resp)
+		r, err := gzip.NewReader(resp.Body)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("could not read gzip response. %q", err))
+		var page ArticleListResponse
+		failOnNotEqual(t, json.NewDecoder(r).Decode(&page), nil, "could not decode compressed list")
+		assert.Len(t, page.Articles, 11)
+	})
+
+	t.Run("should not compress for client not accepting gzip", func(t *testing.T) {
+		for _, acceptEncoding := range []string{"", "gzip;q=0", "br"} {
+			req, _ := makeListArticlesRequestSuite(url.Values{})
+			resp := serve(req, acceptEncoding)
+			assert.Empty(t, resp.Header().Get(HeaderKeyContentEncoding), "for Accept-Encoding %q", acceptEncoding)
+			assert.Equal(t, HeaderKeyAcceptEncoding, resp.Header().Get(HeaderKeyVary))
+			var page ArticleListResponse
+			failOnNotEqual(t, json.NewDecoder(resp.Body).Decode(&page), nil, "could not decode list")
+		}
+	})
+
+	t.Run("should not compress short response", func(t *testing.T) {
+		req, _ := makeGetArticleRequestSuite(a.Slug)
+		resp := serve(req, "gzip")
+		assertStatus(t, http.StatusOK, resp.Code, "for short article")
+		assert.Empty(t, resp.Header().Get(HeaderKeyContentEncoding))
+		assert.Equal(t, HeaderKeyAcceptEncoding, resp.Header().Get(HeaderKeyVary))
+		assert.NotContains(t, resp.Header().Get(HeaderKeyETag), gzipETagSuffix)
+		assert.Contains(t, resp.Body.String(), a.Slug)
+	})
+
+	t.Run("should tag compressed representation and accept its etag in conditions", func(t *testing.T) {
+		long, _ := store.GetArticle(context.Background(), "article-0")
+		req, _ := makeGetArticleRequestSuite(long.Slug)
+		resp := serve(req, "gzip")
+		etag := resp.Header().Get(HeaderKeyETag)
+		assert.Equal(t, encodingGzip, resp.Header().Get(HeaderKeyContentEncoding))
+		assert.True(t, strings.HasSuffix(etag, gzipETagSuffix+`"`), "expected gzip etag, got %s", etag)
+
+		req, _ = makeGetArticleRequestSuite(long.Slug)
+		req.Header.Set(HeaderKeyIfNoneMatch, etag)
+		resp = serve(req, "gzip")
+		assertStatus(t, http.StatusNotModified, resp.Code, "for gzip etag in If-None-Match")
+		assert.Equal(t, etag, resp.Header().Get(HeaderKeyETag))
+		assert.Empty(t, resp.Body.String())
+
+		req, _ = makeGetArticleRequestSuite(long.Slug)
+		req.Header.Set(HeaderKeyIfNoneMatch, etag)
+		resp = serve(req, "")
+		assertStatus(t, http.StatusOK, resp.Code, "for gzip etag from client not accepting gzip")
+		assert.Contains(t, resp.Body.String(), long.Slug)
+	})
+}
@@ -2,22 +2,56 @@ package server
 
 // 422 error descriptions
 const (
-	MsgInvalidBody = "invalid json body"
+	MsgInvalidBody          = "invalid json body"
+	MsgUserAlreadyExists    = "user with such username already exists"
+	MsgArticleAlreadyExists = "article with such title already exists"
+	MsgMissingSearchQuery   = "missing search query"
+	MsgInvalidPaging        = "invalid paging params"
+	MsgInvalidCursor        = "invalid page cursor"
+)
+
+// 429 and 423 error descriptions
+const (
+	MsgTooManyRequests = "too many requests, retry later"
+	MsgAccountLocked   = "account is temporarily locked after failed logins, retry later"
+)
+
+// 412 and 428 error descriptions
+const (
+	MsgVersionConflict      = "resource was changed, get its current version and retry"
+	MsgPreconditionRequired = "If-Match header or Version field is required"
 )
 
 // Auth depended constants
 const (
 	AuthHeader0Part = "Token"
-	authSecretKey   = "qweasdzxc" // move to .env
 )
 
 // Constants for http header keys
 const (
-	HeaderKeyContentType   = "Content-Type"
-	HeaderKeyAuthorization = "Authorization"
+	HeaderKeyContentType     = "Content-Type"
+	HeaderKeyAuthorization   = "Authorization"
+	HeaderKeyRetryAfter      = "Retry-After"
+	HeaderKeyLocation        = "Location"
+	HeaderKeyETag            = "ETag"
+	HeaderKeyIfNoneMatch     = "If-None-Match"
+	HeaderKeyIfMatch         = "If-Match"
+	HeaderKeyCacheControl    = "Cache-Control"
+	HeaderKeyVary            = "Vary"
+	HeaderKeyAcceptEncoding  = "Accept-Encoding"
+	HeaderKeyContentEncoding = "Content-Encoding"
+	HeaderKeyContentLength   = "Content-Length"
+	HeaderKeyXForwardedFor   = "X-Forwarded-For"
+	HeaderKeyXRealIP         = "X-Real-IP"
 )
 
 // Constants for http header values
 const (
 	HeaderValueJSONContactType = "application/json; charset=utf-8"
 )
+
+// ArticlesPath is path prefix of single article resources
+const ArticlesPath = "/api/articles/"
+
+// ArticleSearchPath is path of full-text article search
+const ArticleSearchPath = "/api/articles/search"
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// contractServer is BlogServer which fails the test when request or response doesn't match the OpenAPI document.
+// Requests are checked only if server accepted them, rejected requests are expected to be invalid
+type contractServer struct {
+	*BlogServer
+	t *testing.T
+}
+
+// newContractServer creates blog server for handler tests
+func newContractServer(t *testing.T, s BlogStore, opts ...ServerOption) *contractServer {
+	return &contractServer{BlogServer: NewBlogServer(s, opts...), t: t}
+}
+
+func (s *contractServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.t.Helper()
+	var reqBody []byte
+	if r.Body != nil {
+		reqBody, _ = ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	rec := httptest.NewRecorder()
+	s.BlogServer.ServeHTTP(rec, r)
+	for _, e := range checkContract(openAPIDoc, r, reqBody, rec) {
+		s.t.Errorf("contract violation for %s %s: %s", r.Method, r.URL.Path, e)
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+// checkContract returns differences of request and its response from operation described in doc
+func checkContract(doc openAPIDocument, r *http.Request, reqBody []byte, resp *httptest.ResponseRecorder) []string {
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		return nil
+	}
+	path, params, ok := findOpenAPIPath(doc, r.URL.Path)
+	if !ok {
+		if resp.Code != http.StatusNotFound {
+			return []string{fmt.Sprintf("undocumented path responded with %d", resp.Code)}
+		}
+		return nil
+	}
+	op, ok := doc.Paths[path][strings.ToLower(r.Method)]
+	if !ok {
+		if resp.Code != http.StatusNotFound {
+			return []string{fmt.Sprintf("undocumented method responded with %d", resp.Code)}
+		}
+		return nil
+	}
+	v := contractValidator{doc: doc}
+	if resp.Code < http.StatusBadRequest {
+		v.checkRequest(op, r, params, reqBody)
+	}
+	v.checkResponse(op, resp)
+	return v.errors
+}
+
+// findOpenAPIPath returns documented path which matches request path and values of its path params.
+// Paths without params take precedence as they do in OpenAPI
+func findOpenAPIPath(doc openAPIDocument, requestPath string) (string, map[string]string, bool) {
+	if _, ok := doc.Paths[requestPath]; ok {
+		return requestPath, nil, true
+	}
+	paths := []string{}
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		prefix := openAPIRoute(p)
+		if prefix == p || !strings.HasPrefix(requestPath, prefix) {
+			continue
+		}
+		name := strings.Trim(p[len(prefix):], "{}")
+		return p, map[string]string{name: requestPath[len(prefix):]}, true
+	}
+	return "", nil, false
+}
+
+// contractValidator collects contract violations
+type contractValidator struct {
+	doc    openAPIDocument
+	errors []string
+}
+
+func (v *contractValidator) errorf(format string, args ...interface{}) {
+	v.errors = append(v.errors, fmt.Sprintf(format, args...))
+}
+
+func (v *contractValidator) checkRequest(op *openAPIOperation, r *http.Request, pathParams map[string]string, body []byte) {
+	if len(op.Security) > 0 && !strings.HasPrefix(r.Header.Get(HeaderKeyAuthorization), AuthHeader0Part+" ") {
+		v.errorf("request without %s token was accepted", AuthHeader0Part)
+	}
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = pathParams[p.Name]
+		case "query":
+			values, ok := r.URL.Query()[p.Name]
+			present = ok && len(values) > 0
+			if present {
+				value = values[0]
+			}
+		case "header":
+			value = r.Header.Get(p.Name)
+			present = value != ""
+		}
+		if !present {
+			if p.Required {
+				v.errorf("missing required %s param %s", p.In, p.Name)
+			}
+			continue
+		}
+		v.checkParam("request "+p.In+" param "+p.Name, value, p.Schema)
+	}
+	if op.RequestBody == nil {
+		return
+	}
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			v.errorf("missing request body")
+		}
+		return
+	}
+	v.checkJSON("request body", body, op.RequestBody.Content)
+}
+
+func (v *contractValidator) checkResponse(op *openAPIOperation, resp *httptest.ResponseRecorder) {
+	documented, ok := op.Responses[strconv.Itoa(resp.Code)]
+	if !ok {
+		v.errorf("undocumented response status %d", resp.Code)
+		return
+	}
+	for name := range documented.Headers {
+		if resp.Header().Get(name) == "" {
+			v.errorf("missing %s header in %d response", name, resp.Code)
+		}
+	}
+	if len(documented.Content) == 0 {
+		return
+	}
+	body := resp.Body.Bytes()
+	if resp.Header().Get(HeaderKeyContentEncoding) == encodingGzip {
+		r, e := gzip.NewReader(bytes.NewReader(body))
+		if e == nil {
+			body, e = ioutil.ReadAll(r)
+		}
+		if e != nil {
+			v.errorf("could not decompress response body: %v", e)
+			return
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header().Get(HeaderKeyContentType))
+	if _, ok := documented.Content[mediaType]; !ok {
+		v.errorf("undocumented content type %q of %d response", mediaType, resp.Code)
+		return
+	}
+	v.checkJSON(fmt.Sprintf("%d response body", resp.Code), body, documented.Content)
+}
+
+func (v *contractValidator) checkJSON(name string, body []byte, content map[string]openAPIMediaType) {
+	media, ok := content["application/json"]
+	if !ok {
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var value interface{}
+	if e := d.Decode(&value); e != nil {
+		v.errorf("%s is not json: %v", name, e)
+		return
+	}
+	v.checkValue(name, value, media.Schema)
+}
+
+// checkParam checks string value of request param
+func (v *contractValidator) checkParam(name, value string, schema *openAPISchema) {
+	if schema.Type == "integer" {
+		if _, e := strconv.ParseInt(value, 10, 64); e != nil {
+			v.errorf("%s %q is not integer", name, value)
+			return
+		}
+		v.checkValue(name, json.Number(value), schema)
+		return
+	}
+	v.checkValue(name, value, schema)
+}
+
+// checkValue checks decoded json value against schema
+func (v *contractValidator) checkValue(name string, value interface{}, schema *openAPISchema) {
+	if schema.Ref != "" {
+		referenced, ok := v.doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			v.errorf("%s refers to missing schema %s", name, schema.Ref)
+			return
+		}
+		schema = referenced
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			v.errorf("%s is null", name)
+		}
+		return
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			v.errorf("%s is %T instead of object", name, value)
+			return
+		}
+		for _, required := range schema.Required {
+			if _, ok := object[required]; !ok {
+				v.errorf("%s misses required field %s", name, required)
+			}
+		}
+		for field, fieldValue := range object {
+			if fieldSchema, ok := schema.Properties[field]; ok {
+				v.checkValue(name+"."+field, fieldValue, fieldSchema)
+			} else if schema.AdditionalProperties != nil {
+				v.checkValue(name+"."+field, fieldValue, schema.AdditionalProperties)
+			} else if schema.Properties != nil {
+				v.errorf("%s has undocumented field %s", name, field)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			v.errorf("%s is %T instead of array", name, value)
+			return
+		}
+		for i, item := range items {
+			v.checkValue(fmt.Sprintf("%s[%d]", name, i), item, schema.Items)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			v.errorf("%s is %T instead of string", name, value)
+			return
+		}
+		if schema.Format == "date-time" {
+			if _, e := time.Parse(time.RFC3339Nano, s); e != nil {
+				v.errorf("%s %q is not date-time", name, s)
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			v.errorf("%s is %T instead of %s", name, value, schema.Type)
+			return
+		}
+		f, e := n.Float64()
+		if _, intErr := n.Int64(); e != nil || (schema.Type == "integer" && intErr != nil) {
+			v.errorf("%s %s is not %s", name, n, schema.Type)
+			return
+		}
+		if (schema.Minimum != nil && f < *schema.Minimum) || (schema.Maximum != nil && f > *schema.Maximum) {
+			v.errorf("%s %s is out of range", name, n)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.errorf("%s is %T instead of boolean", name, value)
+		}
+	}
+}
+
+func TestContractValidator(t *testing.T) {
+	check := func(body string, schema *openAPISchema) []string {
+		v := contractValidator{doc: openAPIDoc}
+		v.checkJSON("body", []byte(body), map[string]openAPIMediaType{"application/json": {Schema: schema}})
+		return v.errors
+	}
+	errorsSchema := &openAPISchema{Ref: "#/components/schemas/UnprocessableEntityResponse"}
+
+	t.Run("should accept documented bodies", func(t *testing.T) {
+		for _, body := range []string{newUnprocessableEntityResponse(MsgInvalidBody).Error(), `{"Errors": {"Body": null}}`} {
+			assert.Empty(t, check(body, errorsSchema), "for %s", body)
+		}
+	})
+
+	t.Run("should report violations", func(t *testing.T) {
+		testCases := []struct {
+			body   string
+			schema *openAPISchema
+		}{
+			{`{"Errors": {"Body": "not a list"}}`, errorsSchema},
+			{`{"Errors": {}}`, errorsSchema},
+			{`{"Errors": {"Body": []}, "Extra": 1}`, errorsSchema},
+			{`invalid json`, errorsSchema},
+			{`{"User": {"UserName": "u"}}`, &openAPISchema{Ref: "#/components/schemas/ResponseUser"}},
+			{`1.5`, &openAPISchema{Type: "integer"}},
+			{`"yesterday"`, &openAPISchema{Type: "string", Format: "date-time"}},
+		}
+		for _, tc := range testCases {
+			assert.NotEmpty(t, check(tc.body, tc.schema), "for %s", tc.body)
+		}
+	})
+}
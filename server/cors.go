@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/cors"
+)
+
+// CORSOptions is cross-origin resource sharing configuration. CORS is disabled if no origins are allowed
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// corsExposedHeaders are response headers browsers let cross-origin clients read
+var corsExposedHeaders = []string{HeaderKeyRetryAfter, HeaderKeyLocation, HeaderKeyETag}
+
+// WithCORS enables handling of cross-origin requests including preflight ones
+func WithCORS(o CORSOptions) ServerOption {
+	return func(s *serverOptions) {
+		s.cors = &o
+	}
+}
+
+// applyCORS wraps handler with CORS handling. Preflight requests are answered before routing, so they don't need auth.
+// Authorization and conditional request headers are always allowed
+func applyCORS(o CORSOptions, next http.Handler) http.Handler {
+	if len(o.AllowedOrigins) == 0 {
+		return next
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins:   o.AllowedOrigins,
+		AllowedMethods:   o.AllowedMethods,
+		AllowedHeaders:   withHeaders(o.AllowedHeaders, HeaderKeyAuthorization, HeaderKeyIfNoneMatch, HeaderKeyIfMatch),
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: o.AllowCredentials,
+		MaxAge:           int(o.MaxAge / time.Second),
+	}).Handler(next)
+}
+
+// withHeaders adds headers to the list unless they are already there
+func withHeaders(headers []string, add ...string) []string {
+	for _, h := range add {
+		headers = withHeader(headers, h)
+	}
+	return headers
+}
+
+// withHeader adds header to the list unless it is already there
+func withHeader(headers []string, header string) []string {
+	for _, h := range headers {
+		if h == "*" || strings.EqualFold(h, header) {
+			return headers
+		}
+	}
+	return append(append([]string{}, headers...), header)
+}
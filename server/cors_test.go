@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	const origin = "https://frontend.example.com"
+	server := newContractServer(t, &StubBlogStore{}, WithCORS(CORSOptions{
+		AllowedOrigins:   []string{origin},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{HeaderKeyContentType},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+
+	t.Run("should answer preflight request to route with auth", func(t *testing.T) {
+		req, resp := makePreflightRequestSuite("/api/user", origin, http.MethodPut)
+		server.ServeHTTP(resp, req)
+		assert.Less(t, resp.Code, 300, "expected preflight request to succeed")
+		assert.Equal(t, origin, resp.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, http.MethodPut, resp.Header().Get("Access-Control-Allow-Methods"))
+		assert.Contains(t, resp.Header().Get("Access-Control-Allow-Headers"), HeaderKeyAuthorization)
+		assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("should add cors headers to actual request", func(t *testing.T) {
+		req, resp := makeGetCurrentUserRequestSuite("user1")
+		req.Header.Set("Origin", origin)
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, origin, resp.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, resp.Header().Get("Access-Control-Expose-Headers"), HeaderKeyRetryAfter)
+	})
+
+	t.Run("should not allow unknown origin", func(t *testing.T) {
+		req, resp := makePreflightRequestSuite("/api/user", "https://evil.example.com", http.MethodPut)
+		server.ServeHTTP(resp, req)
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("should not allow unknown method", func(t *testing.T) {
+		req, resp := makePreflightRequestSuite("/api/articles", origin, http.MethodDelete)
+		server.ServeHTTP(resp, req)
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("should be disabled without allowed origins", func(t *testing.T) {
+		server := newContractServer(t, &StubBlogStore{}, WithCORS(CORSOptions{AllowedMethods: []string{http.MethodGet}}))
+		req, resp := makeGetArticleRequestSuite("some-art")
+		req.Header.Set("Origin", origin)
+		server.ServeHTTP(resp, req)
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func makePreflightRequestSuite(path, origin, method string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	req.Header.Set("Access-Control-Request-Headers", "authorization,content-type")
+	return req, httptest.NewRecorder()
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Blog store errors. Store implementations wrap them to keep details, so compare them with errors.Is
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrTimeout       = errors.New("store operation timed out")
+	// ErrVersionConflict is returned when updated data was changed since client got it
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// errPreconditionRequired is returned when client updates resource without specifying its version
+var errPreconditionRequired = errors.New("precondition required")
+
+// errNotArticleAuthor is returned when user changes article of other author
+var errNotArticleAuthor = errors.New("only author can change article")
+
+// contextError returns error of the finished context. Exceeded deadline is reported as ErrTimeout
+func contextError(ctx context.Context) error {
+	e := ctx.Err()
+	if errors.Is(e, context.DeadlineExceeded) {
+		return fmt.Errorf("%v: %w", e, ErrTimeout)
+	}
+	return e
+}
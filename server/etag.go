@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Cache-Control values of cacheable resources. Clients keep responses but revalidate them with ETag on every use
+const (
+	cacheControlPublic  = "public, no-cache"
+	cacheControlPrivate = "private, no-cache"
+)
+
+// etagHashLength is number of sha256 bytes used in ETags
+const etagHashLength = 16
+
+// writeCacheableJSONResponse writes json response with strong ETag and Cache-Control headers.
+// If request has If-None-Match with the same ETag, 304 is written without body
+func writeCacheableJSONResponse(w http.ResponseWriter, r *http.Request, v interface{}, cacheControl string) {
+	body, etag, e := encodeWithETag(v)
+	if e != nil {
+		write500Response(w, e)
+		return
+	}
+	w.Header().Set(HeaderKeyETag, etag)
+	w.Header().Set(HeaderKeyCacheControl, cacheControl)
+	if etagMatches(r.Header.Get(HeaderKeyIfNoneMatch), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSONContentType(w)
+	w.Write(body)
+}
+
+// writeJSONResponseWithETag writes json response with ETag header, so client can update resource again with If-Match
+func writeJSONResponseWithETag(w http.ResponseWriter, v interface{}) {
+	body, etag, e := encodeWithETag(v)
+	if e != nil {
+		write500Response(w, e)
+		return
+	}
+	w.Header().Set(HeaderKeyETag, etag)
+	writeJSONContentType(w)
+	w.Write(body)
+}
+
+func writePreconditionResponse(w http.ResponseWriter, e error) {
+	status, msg := http.StatusPreconditionFailed, MsgVersionConflict
+	if errors.Is(e, errPreconditionRequired) {
+		status, msg = http.StatusPreconditionRequired, MsgPreconditionRequired
+	}
+	writeJSONContentType(w)
+	w.WriteHeader(status)
+	w.Write([]byte(newUnprocessableEntityResponse(msg).Error()))
+}
+
+// versionedRepresentation is representation of resource with version. Its ETag is built from identity and version
+// of the resource rather than from the body, so parts of the body which don't belong to the resource, like auth token, don't change it
+type versionedRepresentation interface {
+	etag() string
+}
+
+// etag returns strong ETag of article representation. It is built from article id and version,
+// and from author profile which is part of the representation but is versioned with the author
+func (a SingleArticleHTTPWrap) etag() string {
+	sum := sha256.Sum256([]byte(a.Author.UserName + "\x00" + a.Author.Bio + "\x00" + a.Author.Image))
+	return fmt.Sprintf(`"article-%d-%d-%s"`, a.ID, a.Version, hex.EncodeToString(sum[:etagHashLength]))
+}
+
+// etag returns strong ETag of user representation. It is the same for every token of the user.
+// Internal user id isn't part of the representation, so login identifies the user instead
+func (u ResponseUser) etag() string {
+	sum := sha256.Sum256([]byte(u.User.UserName))
+	return fmt.Sprintf(`"user-%s-%d"`, hex.EncodeToString(sum[:etagHashLength]), u.User.Version)
+}
+
+// encodeWithETag returns json response body and its ETag
+func encodeWithETag(v interface{}) ([]byte, string, error) {
+	var body bytes.Buffer
+	if e := json.NewEncoder(&body).Encode(v); e != nil {
+		return nil, "", e
+	}
+	if versioned, ok := v.(versionedRepresentation); ok {
+		return body.Bytes(), versioned.etag(), nil
+	}
+	return body.Bytes(), bodyETag(body.Bytes()), nil
+}
+
+// bodyETag returns strong ETag of response body. It is used for resources without version
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:etagHashLength]) + `"`
+}
+
+// requireVersion checks that update request specifies version of resource it changes
+// either by ETag in If-Match header or by version in body
+func requireVersion(r *http.Request, version *int) error {
+	if r.Header.Get(HeaderKeyIfMatch) == "" && version == nil {
+		return errPreconditionRequired
+	}
+	return nil
+}
+
+// checkVersion checks that update request was made for current version of resource.
+// If-Match is compared with ETag of current representation and version from body with current version
+func checkVersion(r *http.Request, current interface{}, currentVersion int, version *int) error {
+	if ifMatch := r.Header.Get(HeaderKeyIfMatch); ifMatch != "" {
+		_, etag, e := encodeWithETag(current)
+		if e != nil {
+			return e
+		}
+		if !etagMatchesStrong(ifMatch, etag) {
+			return fmt.Errorf("etag %s: %w", etag, ErrVersionConflict)
+		}
+	}
+	if version != nil && *version != currentVersion {
+		return fmt.Errorf("version %d: %w", currentVersion, ErrVersionConflict)
+	}
+	return nil
+}
+
+// etagMatchesStrong reports if If-Match header value matches etag. Strong comparison is used as RFC 7232 requires for If-Match
+func etagMatchesStrong(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches reports if If-None-Match header value matches etag. Weak comparison is used as RFC 7232 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArticleETag(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	a, _ := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "cached"}})
+	server := newContractServer(t, store)
+	get := func(ifNoneMatch string) (int, http.Header, string) {
+		req, resp := makeGetArticleRequestSuite(a.Slug)
+		if ifNoneMatch != "" {
+			req.Header.Set(HeaderKeyIfNoneMatch, ifNoneMatch)
+		}
+		server.ServeHTTP(resp, req)
+		return resp.Code, resp.Header(), resp.Body.String()
+	}
+
+	code, header, _ := get("")
+	etag := header.Get(HeaderKeyETag)
+
+	t.Run("should return strong etag and cache control", func(t *testing.T) {
+		assertStatus(t, http.StatusOK, code, "for article without condition")
+		assert.Regexp(t, `^"[0-9a-z-]+"$`, etag)
+		assert.Equal(t, cacheControlPublic, header.Get(HeaderKeyCacheControl))
+	})
+
+	t.Run("should return 304 without body for matching etag", func(t *testing.T) {
+		for _, condition := range []string{etag, `"other", ` + etag, "W/" + etag, "*"} {
+			code, header, body := get(condition)
+			assertStatus(t, http.StatusNotModified, code, "for If-None-Match "+condition)
+			assert.Empty(t, body)
+			assert.Equal(t, etag, header.Get(HeaderKeyETag))
+		}
+	})
+
+	t.Run("should return article for other etag", func(t *testing.T) {
+		code, _, body := get(`"other"`)
+		assertStatus(t, http.StatusOK, code, "for not matching If-None-Match")
+		assert.NotEmpty(t, body)
+	})
+
+	t.Run("should change etag when article changes", func(t *testing.T) {
+		a.Body = "new body"
+		_, err := store.UpdateArticle(context.Background(), a)
+		failOnNotEqual(t, err, nil, "could not update article")
+		code, header, _ := get(etag)
+		assertStatus(t, http.StatusOK, code, "for etag of previous version")
+		assert.NotEqual(t, etag, header.Get(HeaderKeyETag))
+	})
+}
+
+func TestCurrentUserETag(t *testing.T) {
+	username := "user1"
+	server := newContractServer(t, &StubBlogStore{users: []RequestUserData{{CommonUserData: CommonUserData{UserName: username}}}})
+	req, resp := makeGetCurrentUserRequestSuite(username)
+	server.ServeHTTP(resp, req)
+	assert.Equal(t, cacheControlPrivate, resp.Header().Get(HeaderKeyCacheControl))
+
+	t.Run("should return the same etag for other token of the user", func(t *testing.T) {
+		token := earlierToken(username)
+		other, otherResp := makeGetCurrentUserRequestSuite(username)
+		other.Header.Set(HeaderKeyAuthorization, AuthHeader0Part+" "+token)
+		failOnEqual(t, other.Header.Get(HeaderKeyAuthorization), req.Header.Get(HeaderKeyAuthorization), "expected other token")
+		server.ServeHTTP(otherResp, other)
+		assertStatus(t, http.StatusOK, otherResp.Code, "for current user with other token")
+		assert.Equal(t, resp.Header().Get(HeaderKeyETag), otherResp.Header().Get(HeaderKeyETag))
+	})
+
+	t.Run("should return 304 for matching etag", func(t *testing.T) {
+		conditional, notModified := makeGetCurrentUserRequestSuite(username)
+		conditional.Header = req.Header.Clone()
+		conditional.Header.Set(HeaderKeyIfNoneMatch, resp.Header().Get(HeaderKeyETag))
+		server.ServeHTTP(notModified, conditional)
+		assertStatus(t, http.StatusNotModified, notModified.Code, "for current user with matching etag")
+	})
+}
+
+func TestUpdateArticleVersion(t *testing.T) {
+	author := RequestUserData{CommonUserData: CommonUserData{UserName: "author"}}
+	newServer := func(t *testing.T) (*contractServer, Article) {
+		store := NewInMemoryBlogStore()
+		u, _ := store.Registration(context.Background(), author)
+		a, err := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "versioned", AuthorID: sql.NullInt32{Int32: int32(u.ID), Valid: true}}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("could not create test article. %q", err))
+		return newContractServer(t, store), a
+	}
+	update := func(server *contractServer, slug string, a Article, ifMatch string) *httptest.ResponseRecorder {
+		req, resp := makeUpdateArticleRequestSuite(slug, a)
+		setAuth(req, AuthData{author.UserName})
+		if ifMatch != "" {
+			req.Header.Set(HeaderKeyIfMatch, ifMatch)
+		}
+		server.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("should return 428 without version", func(t *testing.T) {
+		server, a := newServer(t)
+		resp := update(server, a.Slug, Article{Title: "New title"}, "")
+		assertStatus(t, http.StatusPreconditionRequired, resp.Code, "for update without version")
+	})
+
+	t.Run("should update by etag of current article and reject it for the next update", func(t *testing.T) {
+		server, a := newServer(t)
+		req, resp := makeGetArticleRequestSuite(a.Slug)
+		server.ServeHTTP(resp, req)
+		etag := resp.Header().Get(HeaderKeyETag)
+
+		resp = update(server, a.Slug, Article{Title: "New title"}, etag)
+		assertStatus(t, http.StatusOK, resp.Code, "for update with current etag")
+		var updated SingleArticleHTTPWrap
+		json.NewDecoder(resp.Body).Decode(&updated)
+		assert.Equal(t, a.Version+1, updated.Version)
+		assert.NotEmpty(t, resp.Header().Get(HeaderKeyETag))
+
+		resp = update(server, updated.Slug, Article{Title: "Lost title"}, etag)
+		assertStatus(t, http.StatusPreconditionFailed, resp.Code, "for update with outdated etag")
+	})
+
+	t.Run("should return 412 for outdated version", func(t *testing.T) {
+		server, a := newServer(t)
+		resp := update(server, a.Slug, Article{Title: "New title", Version: a.Version}, "")
+		assertStatus(t, http.StatusOK, resp.Code, "for update with current version")
+		resp = update(server, "new-title", Article{Title: "Lost title", Version: a.Version}, "")
+		assertStatus(t, http.StatusPreconditionFailed, resp.Code, "for update with outdated version")
+		assertJSONContentType(t, resp)
+	})
+}
+
+func TestUpdateUserVersion(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	u, _ := store.Registration(context.Background(), RequestUserData{CommonUserData: CommonUserData{UserName: "user1"}})
+	server := newContractServer(t, store)
+	bio := "new bio"
+
+	t.Run("should return 428 without version", func(t *testing.T) {
+		req, resp := makeUpdateUserRequestSuite(UpdateUserData{Bio: &bio})
+		setAuth(req, AuthData{u.UserName})
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusPreconditionRequired, resp.Code, "for update without version")
+	})
+
+	t.Run("should update by etag with the original token", func(t *testing.T) {
+		token := earlierToken(u.UserName)
+		withToken := func(req *http.Request) *http.Request {
+			req.Header.Set(HeaderKeyAuthorization, AuthHeader0Part+" "+token)
+			return req
+		}
+		get, resp := makeGetCurrentUserRequestSuite(u.UserName)
+		server.ServeHTTP(resp, withToken(get))
+		etag := resp.Header().Get(HeaderKeyETag)
+
+		for i, b := range []string{"first bio", "second bio"} {
+			b := b
+			req, resp := makeUpdateUserRequestSuite(UpdateUserData{Bio: &b})
+			req.Header.Set(HeaderKeyIfMatch, etag)
+			server.ServeHTTP(resp, withToken(req))
+			assertStatus(t, http.StatusOK, resp.Code, fmt.Sprintf("for update %d with etag of the previous response", i+1))
+			failOnEqual(t, resp.Header().Get(HeaderKeyETag), etag, "expected new etag after update")
+			etag = resp.Header().Get(HeaderKeyETag)
+		}
+
+		get, resp = makeGetCurrentUserRequestSuite(u.UserName)
+		server.ServeHTTP(resp, withToken(get))
+		assert.Equal(t, etag, resp.Header().Get(HeaderKeyETag), "expected etag of update to match etag of get")
+		req, resp := makeUpdateUserRequestSuite(UpdateUserData{Bio: &bio})
+		req.Header.Set(HeaderKeyIfMatch, `"user-0-0"`)
+		server.ServeHTTP(resp, withToken(req))
+		assertStatus(t, http.StatusPreconditionFailed, resp.Code, "for update with other etag")
+		current, _ := store.GetUser(context.Background(), u.UserName)
+		u.Version = current.Version
+	})
+
+	t.Run("should update current version only once", func(t *testing.T) {
+		for _, code := range []int{http.StatusOK, http.StatusPreconditionFailed} {
+			req, resp := makeUpdateUserRequestSuite(UpdateUserData{Bio: &bio, Version: &u.Version})
+			setAuth(req, AuthData{u.UserName})
+			server.ServeHTTP(resp, req)
+			assertStatus(t, code, resp.Code, fmt.Sprintf("for update of version %d", u.Version))
+		}
+	})
+}
+
+// earlierToken returns valid token of the user which differs from tokens created by CreateToken now
+func earlierToken(username string) string {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, AuthClaims{
+		User:           AuthData{username},
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix(), IssuedAt: time.Now().Add(-time.Minute).Unix()},
+	}).SignedString([]byte(authSecretKey))
+	return token
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Health probe component statuses
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+	HealthStatusDraining    = "draining"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// ReadinessChecker is implemented by stores which are able to report if their backend is reachable
+type ReadinessChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthStatus is http response model for health probes
+type HealthStatus struct {
+	Status     string
+	Components map[string]string `json:",omitempty"`
+}
+
+// StartDraining marks server as draining so readiness probe starts to fail
+func (s *BlogServer) StartDraining() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// IsDraining reports if server is draining
+func (s *BlogServer) IsDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+func (s *BlogServer) serveLiveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthResponse(w, http.StatusOK, HealthStatus{Status: HealthStatusOK})
+}
+
+func (s *BlogServer) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	code := http.StatusOK
+	status := HealthStatus{Status: HealthStatusOK, Components: map[string]string{"server": HealthStatusOK}}
+	if s.IsDraining() {
+		code = http.StatusServiceUnavailable
+		status.Components["server"] = HealthStatusDraining
+	}
+	if checker, ok := s.Store.(ReadinessChecker); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := checker.Ping(ctx); err != nil {
+			code = http.StatusServiceUnavailable
+			status.Components["db"] = HealthStatusUnavailable
+		} else {
+			status.Components["db"] = HealthStatusOK
+		}
+	}
+	if code != http.StatusOK {
+		status.Status = HealthStatusUnavailable
+	}
+	writeHealthResponse(w, code, status)
+}
+
+func (s *BlogServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	values := map[string]interface{}{}
+	for name, value := range s.metrics {
+		values[name] = value()
+	}
+	writeJSONResponse(w, values)
+}
+
+func writeHealthResponse(w http.ResponseWriter, code int, status HealthStatus) {
+	writeJSONContentType(w)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
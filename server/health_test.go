@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PingStubBlogStore struct {
+	StubBlogStore
+	pingError error
+}
+
+func (s *PingStubBlogStore) Ping(ctx context.Context) error {
+	return s.pingError
+}
+
+func TestLiveness(t *testing.T) {
+	server := newContractServer(t, &PingStubBlogStore{pingError: fmt.Errorf("db is down")})
+
+	t.Run("should return 200 even if db is unreachable", func(t *testing.T) {
+		req, resp := makeHealthRequestSuite("/healthz")
+		server.ServeHTTP(resp, req)
+		status := assertHealthResponse(t, resp, http.StatusOK)
+		assert.Equal(t, HealthStatusOK, status.Status)
+	})
+}
+
+func TestReadiness(t *testing.T) {
+	t.Run("should return 200 with component statuses for reachable db", func(t *testing.T) {
+		server := newContractServer(t, &PingStubBlogStore{})
+		req, resp := makeHealthRequestSuite("/readyz")
+		server.ServeHTTP(resp, req)
+		status := assertHealthResponse(t, resp, http.StatusOK)
+		assert.Equal(t, HealthStatusOK, status.Status)
+		assert.Equal(t, HealthStatusOK, status.Components["db"], "expected db component to be ok")
+		assert.Equal(t, HealthStatusOK, status.Components["server"], "expected server component to be ok")
+	})
+
+	t.Run("should return 503 for unreachable db", func(t *testing.T) {
+		server := newContractServer(t, &PingStubBlogStore{pingError: fmt.Errorf("db is down")})
+		req, resp := makeHealthRequestSuite("/readyz")
+		server.ServeHTTP(resp, req)
+		status := assertHealthResponse(t, resp, http.StatusServiceUnavailable)
+		assert.Equal(t, HealthStatusUnavailable, status.Status)
+		assert.Equal(t, HealthStatusUnavailable, status.Components["db"], "expected db component to be unavailable")
+	})
+
+	t.Run("should return 503 for draining server", func(t *testing.T) {
+		server := newContractServer(t, &PingStubBlogStore{})
+		server.StartDraining()
+		req, resp := makeHealthRequestSuite("/readyz")
+		server.ServeHTTP(resp, req)
+		status := assertHealthResponse(t, resp, http.StatusServiceUnavailable)
+		assert.Equal(t, HealthStatusDraining, status.Components["server"], "expected server component to be draining")
+	})
+
+	t.Run("should not report db component for store without readiness check", func(t *testing.T) {
+		server := newContractServer(t, &StubBlogStore{})
+		req, resp := makeHealthRequestSuite("/readyz")
+		server.ServeHTTP(resp, req)
+		status := assertHealthResponse(t, resp, http.StatusOK)
+		_, hasDB := status.Components["db"]
+		assert.False(t, hasDB, "expected no db component in readiness response")
+	})
+}
+
+func makeHealthRequestSuite(path string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	return req, httptest.NewRecorder()
+}
+
+func assertHealthResponse(t *testing.T, resp *httptest.ResponseRecorder, code int) HealthStatus {
+	t.Helper()
+	assertStatus(t, code, resp.Code, "on health probe")
+	assertJSONContentType(t, resp)
+	var status HealthStatus
+	err := json.NewDecoder(resp.Body).Decode(&status)
+	failOnNotEqual(t, err, nil, fmt.Sprintf("unable to decode health response %q. Got error %q", resp.Body.String(), err))
+	return status
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("should report registered metrics", func(t *testing.T) {
+		server := newContractServer(t, &StubBlogStore{}, WithMetrics("requests", func() interface{} { return 42 }))
+		req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		var metrics map[string]int
+		assertSussessJSONResponse(t, resp, &metrics)
+		assert.Equal(t, map[string]int{"requests": 42}, metrics)
+	})
+}
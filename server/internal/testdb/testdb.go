@@ -0,0 +1,65 @@
+// Package testdb provisions isolated databases for tests
+package testdb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	// postgres driver
+	_ "github.com/lib/pq"
+)
+
+// DSNEnv is environment variable with dsn of postgres db which tests may use
+const DSNEnv = "BLOG_TEST_DSN"
+
+// Postgres creates schema with unique name in db from DSNEnv and returns dsn which uses the schema by default.
+// Schema is dropped with all its data when test finishes. Test is skipped if DSNEnv is not set
+func Postgres(t testing.TB) string {
+	t.Helper()
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set, skipping postgres tests", DSNEnv)
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("could not connect to test db from %s: %v", DSNEnv, err)
+	}
+	schema := "blog_test_" + randomSuffix(t)
+	if _, err = db.Exec("CREATE SCHEMA " + schema); err != nil {
+		db.Close()
+		t.Fatalf("could not create test schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		defer db.Close()
+		if _, err := db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("could not drop test schema %s: %v", schema, err)
+		}
+	})
+	return withSearchPath(dsn, schema)
+}
+
+// withSearchPath adds search_path connection param to postgres dsn in url or key=value format
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			q := u.Query()
+			q.Set("search_path", schema)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
+
+func randomSuffix(t testing.TB) string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("could not generate test schema name: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
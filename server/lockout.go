@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LockoutPolicy locks username for LockDuration after MaxFailures failed logins in a row.
+// Every next failure doubles the lock up to MaxLockDuration. Zero MaxFailures disables lockout
+type LockoutPolicy struct {
+	MaxFailures     int
+	LockDuration    time.Duration
+	MaxLockDuration time.Duration
+}
+
+// WithLockout enables temporary lock of usernames after repeated failed logins
+func WithLockout(p LockoutPolicy) ServerOption {
+	return func(s *serverOptions) {
+		s.lockout = p
+	}
+}
+
+// errInvalidCredentials is returned when username is not found or password is wrong
+var errInvalidCredentials = fmt.Errorf("invalid credentials: %w", ErrNotFound)
+
+// lockDuration returns how long username is locked after given number of failures in a row
+func (p LockoutPolicy) lockDuration(failures int) time.Duration {
+	if p.MaxFailures == 0 || failures < p.MaxFailures {
+		return 0
+	}
+	d := p.LockDuration
+	for i := p.MaxFailures; i < failures && (p.MaxLockDuration == 0 || d < p.MaxLockDuration); i++ {
+		d *= 2
+	}
+	if p.MaxLockDuration > 0 && d > p.MaxLockDuration {
+		d = p.MaxLockDuration
+	}
+	return d
+}
+
+// authenticate checks credentials and tracks failed attempts. Locked username is reported with time left until unlock.
+// Missing usernames are tracked and locked the same way as existing ones, so responses don't reveal which usernames exist
+func (s *BlogServer) authenticate(ctx context.Context, credentials RequestUserData) (RequestUserData, time.Duration, error) {
+	var u RequestUserData
+	var lockedFor time.Duration
+	var authenticated bool
+	// attempts are locked by the store while they are counted, so concurrent failures don't need serializable retries
+	e := s.Store.InTx(withReadCommittedTx(ctx), func(tx BlogStore) (err error) {
+		lockedFor, authenticated = 0, false
+		var attempts LoginAttempts
+		if s.lockout.MaxFailures > 0 {
+			if attempts, err = tx.GetLoginAttempts(ctx, credentials.UserName); err != nil {
+				return err
+			}
+			if now := s.now(); attempts.LockedUntil.Valid && now.Before(attempts.LockedUntil.Time) {
+				lockedFor = attempts.LockedUntil.Time.Sub(now)
+				return nil
+			}
+		}
+		if u, err = tx.GetUser(ctx, credentials.UserName); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		authenticated = err == nil && u.Password == credentials.Password
+		return s.trackLoginAttempt(ctx, tx, attempts, authenticated)
+	})
+	switch {
+	case e != nil:
+		return RequestUserData{}, 0, e
+	case lockedFor > 0:
+		return RequestUserData{}, lockedFor, nil
+	case !authenticated:
+		return RequestUserData{}, 0, errInvalidCredentials
+	}
+	return u, 0, nil
+}
+
+// trackLoginAttempt counts failed login and locks username if needed. Successful login forgets failures
+func (s *BlogServer) trackLoginAttempt(ctx context.Context, tx BlogStore, attempts LoginAttempts, authenticated bool) error {
+	switch {
+	case s.lockout.MaxFailures == 0:
+		return nil
+	case authenticated && attempts.Failures > 0:
+		return tx.ResetLoginAttempts(ctx, attempts.Login)
+	case !authenticated:
+		attempts.Failures++
+		if d := s.lockout.lockDuration(attempts.Failures); d > 0 {
+			attempts.LockedUntil = sql.NullTime{Time: s.now().UTC().Add(d).Truncate(time.Microsecond), Valid: true}
+		}
+		return tx.SaveLoginAttempts(ctx, attempts)
+	}
+	return nil
+}
+
+func writeLockedResponse(w http.ResponseWriter, lockedFor time.Duration) {
+	writeJSONContentType(w)
+	w.Header().Set(HeaderKeyRetryAfter, strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	w.WriteHeader(http.StatusLocked)
+	w.Write([]byte(newUnprocessableEntityResponse(MsgAccountLocked).Error()))
+}
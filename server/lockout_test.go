@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockDuration(t *testing.T) {
+	p := LockoutPolicy{MaxFailures: 3, LockDuration: time.Minute, MaxLockDuration: 5 * time.Minute}
+	testCases := map[int]time.Duration{
+		0:   0,
+		2:   0,
+		3:   time.Minute,
+		4:   2 * time.Minute,
+		5:   4 * time.Minute,
+		6:   5 * time.Minute,
+		100: 5 * time.Minute,
+	}
+	for failures, want := range testCases {
+		assert.Equal(t, want, p.lockDuration(failures), "unexpected lock duration after %d failures", failures)
+	}
+	assert.Equal(t, time.Duration(0), LockoutPolicy{}.lockDuration(100), "expected disabled lockout not to lock")
+}
+
+func TestLockout(t *testing.T) {
+	user := RequestUserData{CommonUserData: CommonUserData{UserName: "user1", Email: "e"}, Password: "123"}
+	wrongPassword := user
+	wrongPassword.Password = "wrong"
+	newServer := func(t *testing.T) (*contractServer, *time.Time) {
+		store := NewInMemoryBlogStore()
+		store.Registration(context.Background(), user)
+		server := newContractServer(t, store, WithLockout(LockoutPolicy{MaxFailures: 3, LockDuration: time.Minute, MaxLockDuration: 4 * time.Minute}))
+		now := time.Now()
+		server.now = func() time.Time { return now }
+		return server, &now
+	}
+	login := func(server *contractServer, u RequestUserData) *http.Response {
+		req, resp := makeAuthenticationRequestSuite(u)
+		server.ServeHTTP(resp, req)
+		return resp.Result()
+	}
+
+	t.Run("should lock username after failures in a row", func(t *testing.T) {
+		server, _ := newServer(t)
+		for i := 0; i < 3; i++ {
+			assertStatus(t, http.StatusNotFound, login(server, wrongPassword).StatusCode, fmt.Sprintf("on failed login %d", i+1))
+		}
+		resp := login(server, user)
+		assertStatus(t, http.StatusLocked, resp.StatusCode, "for correct password of locked username")
+		assert.Equal(t, "60", resp.Header.Get(HeaderKeyRetryAfter))
+	})
+
+	t.Run("should lock missing username the same way", func(t *testing.T) {
+		server, _ := newServer(t)
+		missing := RequestUserData{CommonUserData: CommonUserData{UserName: "missing"}, Password: "123"}
+		for i := 0; i < 3; i++ {
+			assertStatus(t, http.StatusNotFound, login(server, missing).StatusCode, fmt.Sprintf("on failed login %d", i+1))
+		}
+		assertStatus(t, http.StatusLocked, login(server, missing).StatusCode, "for locked missing username")
+	})
+
+	t.Run("should unlock automatically and double the next lock", func(t *testing.T) {
+		server, now := newServer(t)
+		for i := 0; i < 3; i++ {
+			login(server, wrongPassword)
+		}
+		*now = now.Add(time.Minute)
+		assertStatus(t, http.StatusNotFound, login(server, wrongPassword).StatusCode, "for failed login after lock expired")
+		resp := login(server, user)
+		assertStatus(t, http.StatusLocked, resp.StatusCode, "after failure following expired lock")
+		assert.Equal(t, "120", resp.Header.Get(HeaderKeyRetryAfter))
+	})
+
+	t.Run("should forget failures after successful login", func(t *testing.T) {
+		server, _ := newServer(t)
+		for i := 0; i < 2; i++ {
+			login(server, wrongPassword)
+		}
+		assertStatus(t, http.StatusOK, login(server, user).StatusCode, "for correct password before lock")
+		for i := 0; i < 2; i++ {
+			assertStatus(t, http.StatusNotFound, login(server, wrongPassword).StatusCode, fmt.Sprintf("on failed login %d after success", i+1))
+		}
+	})
+
+	t.Run("should unlock by admin action", func(t *testing.T) {
+		server, _ := newServer(t)
+		for i := 0; i < 3; i++ {
+			login(server, wrongPassword)
+		}
+		err := server.Store.ResetLoginAttempts(context.Background(), user.UserName)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected login attempts to be reset but got %q", err))
+		assertStatus(t, http.StatusOK, login(server, user).StatusCode, "for unlocked username")
+	})
+
+	t.Run("should not track attempts when disabled", func(t *testing.T) {
+		store := &StubBlogStore{users: []RequestUserData{user}}
+		server := newContractServer(t, store)
+		for i := 0; i < 10; i++ {
+			login(server, wrongPassword)
+		}
+		assert.Empty(t, store.loginAttempts)
+		assertStatus(t, http.StatusOK, login(server, user).StatusCode, "without lockout")
+	})
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is concurrency safe cache of limited size. The least recently used entry is evicted when cache is full
+// and entries expire after ttl. Every removal bumps generation, so values loaded before removal are not cached
+type lruCache struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	now        func() time.Time
+	entries    map[string]*list.Element
+	order      *list.List
+	generation uint64
+	counters   CacheCounters
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{size: size, ttl: ttl, now: time.Now, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get returns cached value of the key and counts hit or miss. On miss it returns generation to pass to set
+func (c *lruCache) get(key string) (interface{}, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		if c.now().Before(e.expires) {
+			c.order.MoveToFront(el)
+			c.counters.Hits++
+			return e.value, c.generation, true
+		}
+		c.removeElement(el)
+	}
+	c.counters.Misses++
+	return nil, c.generation, false
+}
+
+// set caches value unless some entries were removed since generation was got
+func (c *lruCache) set(key string, value interface{}, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		c.counters.Evictions++
+	}
+}
+
+// remove removes entries of the keys
+func (c *lruCache) remove(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.removeElement(el)
+		}
+	}
+}
+
+// removeIf removes entries with values matching f
+func (c *lruCache) removeIf(f func(value interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, el := range c.entries {
+		if f(el.Value.(*lruEntry).value) {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
+
+// stats returns counters of cache usage
+func (c *lruCache) stats() CacheCounters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counters := c.counters
+	counters.Size = c.order.Len()
+	return counters
+}
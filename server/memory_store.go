@@ -0,0 +1,487 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InMemoryBlogStore is concurrency safe implementation of blog store which keeps data in memory
+type InMemoryBlogStore struct {
+	mu    sync.RWMutex
+	state memoryState
+}
+
+// memoryState is in memory blog data. It is not concurrency safe by itself.
+// Articles and users are indexed by slug and username. Ids are not reused after rollback, as db sequences are not
+type memoryState struct {
+	articles      map[int]Article
+	articleSlugs  map[string]int
+	users         map[int]RequestUserData
+	userLogins    map[string]int
+	slugHistory   map[string]int
+	loginAttempts map[string]LoginAttempts
+	lastArticleID int
+	lastUserID    int
+	// undo is log of changes made by running transaction. Changes are reverted in reverse order if it fails
+	undo []func()
+}
+
+// NewInMemoryBlogStore initializes new empty in memory blog store
+func NewInMemoryBlogStore() *InMemoryBlogStore {
+	return &InMemoryBlogStore{state: memoryState{
+		articles:      map[int]Article{},
+		articleSlugs:  map[string]int{},
+		users:         map[int]RequestUserData{},
+		userLogins:    map[string]int{},
+		slugHistory:   map[string]int{},
+		loginAttempts: map[string]LoginAttempts{},
+	}}
+}
+
+// Close does nothing. It is here to be interchangeable with db stores
+func (s *InMemoryBlogStore) Close() error {
+	return nil
+}
+
+// GetArticle returns article by slug
+func (s *InMemoryBlogStore) GetArticle(ctx context.Context, slug string) (Article, error) {
+	if e := contextError(ctx); e != nil {
+		return Article{}, e
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.getArticle(slug)
+}
+
+// CreateArticle creates article with unique slug
+func (s *InMemoryBlogStore) CreateArticle(ctx context.Context, a SingleArticleHTTPWrap) (Article, error) {
+	if e := contextError(ctx); e != nil {
+		return a.Article, e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.createArticle(a)
+}
+
+// UpdateArticle updates article found by id. Previous slug is kept in history
+func (s *InMemoryBlogStore) UpdateArticle(ctx context.Context, a Article) (Article, error) {
+	if e := contextError(ctx); e != nil {
+		return a, e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.updateArticle(a)
+}
+
+// ListArticles returns page of articles ordered from newest to oldest
+func (s *InMemoryBlogStore) ListArticles(ctx context.Context, q ArticleListQuery) ([]Article, error) {
+	if e := contextError(ctx); e != nil {
+		return nil, e
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.listArticles(q), nil
+}
+
+// SearchArticles finds articles containing every search term. Matches in title rank higher than in description and body
+func (s *InMemoryBlogStore) SearchArticles(ctx context.Context, q ArticleSearchQuery) (ArticleSearchResult, error) {
+	if e := contextError(ctx); e != nil {
+		return ArticleSearchResult{}, e
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.searchArticles(q), nil
+}
+
+// GetUser returns user by username
+func (s *InMemoryBlogStore) GetUser(ctx context.Context, username string) (RequestUserData, error) {
+	if e := contextError(ctx); e != nil {
+		return RequestUserData{}, e
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.getUser(username)
+}
+
+// UpdateUser updates user found by username
+func (s *InMemoryBlogStore) UpdateUser(ctx context.Context, username string, data RequestUserData) (RequestUserData, error) {
+	if e := contextError(ctx); e != nil {
+		return data, e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.updateUser(username, data)
+}
+
+// Registration creates user with unique username
+func (s *InMemoryBlogStore) Registration(ctx context.Context, user RequestUserData) (RequestUserData, error) {
+	if e := contextError(ctx); e != nil {
+		return user, e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.registration(user)
+}
+
+// GetLoginAttempts returns failed login attempts of username
+func (s *InMemoryBlogStore) GetLoginAttempts(ctx context.Context, username string) (LoginAttempts, error) {
+	if e := contextError(ctx); e != nil {
+		return LoginAttempts{}, e
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.getLoginAttempts(username), nil
+}
+
+// SaveLoginAttempts inserts or replaces failed login attempts of username
+func (s *InMemoryBlogStore) SaveLoginAttempts(ctx context.Context, a LoginAttempts) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.putLoginAttempts(a)
+	return nil
+}
+
+// ResetLoginAttempts forgets failed login attempts of username
+func (s *InMemoryBlogStore) ResetLoginAttempts(ctx context.Context, username string) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.deleteLoginAttempts(username)
+	return nil
+}
+
+// InTx runs f which changes store data in place. Changes are logged and reverted if f fails. Store is locked while f runs
+func (s *InMemoryBlogStore) InTx(ctx context.Context, f func(tx BlogStore) error) error {
+	if e := contextError(ctx); e != nil {
+		return e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.undo = []func(){}
+	committed := false
+	defer func() {
+		if !committed {
+			s.state.rollback()
+		}
+		s.state.undo = nil
+	}()
+	if e := f(&memoryTx{state: &s.state}); e != nil {
+		return e
+	}
+	committed = true
+	return nil
+}
+
+// memoryTx is blog store bound to in memory transaction
+type memoryTx struct {
+	state *memoryState
+}
+
+func (tx *memoryTx) GetArticle(ctx context.Context, slug string) (Article, error) {
+	return tx.state.getArticle(slug)
+}
+
+func (tx *memoryTx) CreateArticle(ctx context.Context, a SingleArticleHTTPWrap) (Article, error) {
+	return tx.state.createArticle(a)
+}
+
+func (tx *memoryTx) UpdateArticle(ctx context.Context, a Article) (Article, error) {
+	return tx.state.updateArticle(a)
+}
+
+func (tx *memoryTx) ListArticles(ctx context.Context, q ArticleListQuery) ([]Article, error) {
+	return tx.state.listArticles(q), nil
+}
+
+func (tx *memoryTx) SearchArticles(ctx context.Context, q ArticleSearchQuery) (ArticleSearchResult, error) {
+	return tx.state.searchArticles(q), nil
+}
+
+func (tx *memoryTx) GetUser(ctx context.Context, username string) (RequestUserData, error) {
+	return tx.state.getUser(username)
+}
+
+func (tx *memoryTx) UpdateUser(ctx context.Context, username string, data RequestUserData) (RequestUserData, error) {
+	return tx.state.updateUser(username, data)
+}
+
+func (tx *memoryTx) Registration(ctx context.Context, user RequestUserData) (RequestUserData, error) {
+	return tx.state.registration(user)
+}
+
+func (tx *memoryTx) GetLoginAttempts(ctx context.Context, username string) (LoginAttempts, error) {
+	return tx.state.getLoginAttempts(username), nil
+}
+
+func (tx *memoryTx) SaveLoginAttempts(ctx context.Context, a LoginAttempts) error {
+	tx.state.putLoginAttempts(a)
+	return nil
+}
+
+func (tx *memoryTx) ResetLoginAttempts(ctx context.Context, username string) error {
+	tx.state.deleteLoginAttempts(username)
+	return nil
+}
+
+func (tx *memoryTx) InTx(ctx context.Context, f func(tx BlogStore) error) error {
+	return f(tx)
+}
+
+// logUndo keeps revert of a change if transaction is running
+func (m *memoryState) logUndo(revert func()) {
+	if m.undo != nil {
+		m.undo = append(m.undo, revert)
+	}
+}
+
+// rollback reverts changes of running transaction
+func (m *memoryState) rollback() {
+	for i := len(m.undo) - 1; i >= 0; i-- {
+		m.undo[i]()
+	}
+}
+
+// putArticle inserts or replaces article and its slug in the index
+func (m *memoryState) putArticle(a Article) {
+	prev, existed := m.articles[a.ID]
+	m.logUndo(func() {
+		delete(m.articleSlugs, a.Slug)
+		if existed {
+			m.articles[a.ID] = prev
+			m.articleSlugs[prev.Slug] = prev.ID
+		} else {
+			delete(m.articles, a.ID)
+		}
+	})
+	if existed {
+		delete(m.articleSlugs, prev.Slug)
+	}
+	m.articles[a.ID] = a
+	m.articleSlugs[a.Slug] = a.ID
+}
+
+// putUser inserts or replaces user and its username in the index
+func (m *memoryState) putUser(u RequestUserData) {
+	prev, existed := m.users[u.ID]
+	m.logUndo(func() {
+		delete(m.userLogins, u.UserName)
+		if existed {
+			m.users[u.ID] = prev
+			m.userLogins[prev.UserName] = prev.ID
+		} else {
+			delete(m.users, u.ID)
+		}
+	})
+	if existed {
+		delete(m.userLogins, prev.UserName)
+	}
+	m.users[u.ID] = u
+	m.userLogins[u.UserName] = u.ID
+}
+
+// setSlugHistory points retired slug to article id. Zero id removes the slug from history
+func (m *memoryState) setSlugHistory(slug string, id int) {
+	prev, existed := m.slugHistory[slug]
+	m.logUndo(func() {
+		if existed {
+			m.slugHistory[slug] = prev
+		} else {
+			delete(m.slugHistory, slug)
+		}
+	})
+	if id == 0 {
+		delete(m.slugHistory, slug)
+	} else {
+		m.slugHistory[slug] = id
+	}
+}
+
+func (m *memoryState) putLoginAttempts(a LoginAttempts) {
+	m.restoreLoginAttemptsOnUndo(a.Login)
+	m.loginAttempts[a.Login] = a
+}
+
+func (m *memoryState) deleteLoginAttempts(username string) {
+	m.restoreLoginAttemptsOnUndo(username)
+	delete(m.loginAttempts, username)
+}
+
+func (m *memoryState) restoreLoginAttemptsOnUndo(username string) {
+	prev, existed := m.loginAttempts[username]
+	m.logUndo(func() {
+		if existed {
+			m.loginAttempts[username] = prev
+		} else {
+			delete(m.loginAttempts, username)
+		}
+	})
+}
+
+func (m *memoryState) getArticle(slug string) (Article, error) {
+	if id, ok := m.articleSlugs[slug]; ok {
+		return m.withAuthor(m.articles[id]), nil
+	}
+	if id, ok := m.slugHistory[slug]; ok {
+		return m.withAuthor(m.articles[id]), nil
+	}
+	return Article{}, fmt.Errorf("article with slug %q: %w", slug, ErrNotFound)
+}
+
+func (m *memoryState) createArticle(a SingleArticleHTTPWrap) (Article, error) {
+	slug, ok := m.availableSlug(0, CreateSlug(a.Title))
+	if !ok {
+		return a.Article, fmt.Errorf("article with slug %q: %w", slug, ErrAlreadyExists)
+	}
+	a.Slug = slug
+	if a.AuthorID.Valid {
+		if _, ok := m.users[int(a.AuthorID.Int32)]; !ok {
+			return a.Article, fmt.Errorf("author with id %d: %w", a.AuthorID.Int32, ErrNotFound)
+		}
+	}
+	m.lastArticleID++
+	a.ID = m.lastArticleID
+	a.Author = Profile{}
+	a.CreatedAt = memoryNow()
+	a.UpdatedAt = a.CreatedAt
+	a.Version = 1
+	m.putArticle(a.Article)
+	return m.withAuthor(a.Article), nil
+}
+
+func (m *memoryState) updateArticle(a Article) (Article, error) {
+	current, ok := m.articles[a.ID]
+	if !ok {
+		return a, fmt.Errorf("article with id %d: %w", a.ID, ErrNotFound)
+	}
+	if a.Version != 0 && a.Version != current.Version {
+		return a, fmt.Errorf("article with id %d of version %d: %w", a.ID, a.Version, ErrVersionConflict)
+	}
+	slug := current.Slug
+	if CreateSlug(a.Title) != CreateSlug(current.Title) {
+		if slug, ok = m.availableSlug(a.ID, CreateSlug(a.Title)); !ok {
+			return a, fmt.Errorf("article with slug %q: %w", slug, ErrAlreadyExists)
+		}
+	}
+	current.Title = a.Title
+	current.Description = a.Description
+	current.Body = a.Body
+	current.UpdatedAt = memoryNow()
+	current.Version++
+	if slug != current.Slug {
+		m.setSlugHistory(slug, 0)
+		m.setSlugHistory(current.Slug, current.ID)
+		current.Slug = slug
+	}
+	m.putArticle(current)
+	return m.withAuthor(current), nil
+}
+
+func (m *memoryState) listArticles(q ArticleListQuery) []Article {
+	articles := []Article{}
+	for _, a := range m.articles {
+		c := ArticleCursor{CreatedAt: a.CreatedAt, ID: a.ID}
+		if (q.After == nil || c.Less(*q.After)) && (q.Before == nil || q.Before.Less(c)) {
+			articles = append(articles, m.withAuthor(a))
+		}
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return ArticleCursor{articles[j].CreatedAt, articles[j].ID}.Less(ArticleCursor{articles[i].CreatedAt, articles[i].ID})
+	})
+	if len(articles) > q.Limit {
+		if q.Before != nil {
+			return articles[len(articles)-q.Limit:]
+		}
+		return articles[:q.Limit]
+	}
+	return articles
+}
+
+func (m *memoryState) searchArticles(q ArticleSearchQuery) ArticleSearchResult {
+	articles := make([]Article, 0, len(m.articles))
+	for _, a := range m.articles {
+		articles = append(articles, m.withAuthor(a))
+	}
+	return rankArticles(articles, q)
+}
+
+// availableSlug returns first slug candidate which is not used by other articles now or in the past
+func (m *memoryState) availableSlug(articleID int, slug string) (string, bool) {
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		candidate := slugCandidate(slug, attempt)
+		if a, err := m.getArticle(candidate); err != nil || a.ID == articleID {
+			return candidate, true
+		}
+	}
+	return slug, false
+}
+
+func (m *memoryState) getUser(username string) (RequestUserData, error) {
+	if u, ok := m.findUser(username); ok {
+		return u, nil
+	}
+	return RequestUserData{}, fmt.Errorf("user with username %q: %w", username, ErrNotFound)
+}
+
+func (m *memoryState) updateUser(username string, data RequestUserData) (RequestUserData, error) {
+	u, ok := m.findUser(username)
+	if !ok {
+		return data, fmt.Errorf("user with username %q: %w", username, ErrNotFound)
+	}
+	if data.Version != 0 && data.Version != u.Version {
+		return data, fmt.Errorf("user with username %q of version %d: %w", username, data.Version, ErrVersionConflict)
+	}
+	if other, ok := m.findUser(data.UserName); ok && other.ID != u.ID {
+		return data, fmt.Errorf("user with username %q: %w", data.UserName, ErrAlreadyExists)
+	}
+	data.ID = u.ID
+	data.Version = u.Version + 1
+	m.putUser(data)
+	return data, nil
+}
+
+func (m *memoryState) registration(user RequestUserData) (RequestUserData, error) {
+	if _, ok := m.findUser(user.UserName); ok {
+		return user, fmt.Errorf("user with username %q: %w", user.UserName, ErrAlreadyExists)
+	}
+	m.lastUserID++
+	user.ID = m.lastUserID
+	user.Version = 1
+	m.putUser(user)
+	return user, nil
+}
+
+func (m *memoryState) getLoginAttempts(username string) LoginAttempts {
+	if a, ok := m.loginAttempts[username]; ok {
+		return a
+	}
+	return LoginAttempts{Login: username}
+}
+
+func (m *memoryState) findUser(username string) (RequestUserData, bool) {
+	if id, ok := m.userLogins[username]; ok {
+		return m.users[id], true
+	}
+	return RequestUserData{}, false
+}
+
+func (m *memoryState) withAuthor(a Article) Article {
+	if a.AuthorID.Valid {
+		if u, ok := m.users[int(a.AuthorID.Int32)]; ok {
+			a.Author = u.ToProfile()
+		}
+	}
+	return a
+}
+
+// memoryNow returns current time with precision of db timestamps
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryArticles(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	author, _ := store.Registration(context.Background(), RequestUserData{CommonUserData: CommonUserData{UserName: "author"}})
+
+	t.Run("should create article with id, slug and author", func(t *testing.T) {
+		a, err := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "memory article", AuthorID: sql.NullInt32{Int32: int32(author.ID), Valid: true}}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article to be created without error but got %q", err))
+		assert.NotZero(t, a.ID, "expected created article to have an id")
+		assert.Equal(t, "memory-article", a.Slug)
+		assert.Equal(t, author.UserName, a.Author.UserName, "expected created article to have author")
+		assert.False(t, a.CreatedAt.IsZero(), "expected created article to have creation time")
+		assert.Equal(t, a.CreatedAt, a.UpdatedAt, "expected update time of created article to be equal to creation time")
+
+		found, err := store.GetArticle(context.Background(), a.Slug)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find created article but got %q", err))
+		assert.Equal(t, a, found)
+	})
+
+	t.Run("should add suffix to duplicate slug", func(t *testing.T) {
+		a, err := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "Memory   Article"}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article with duplicate slug to be created but got %q", err))
+		assert.Equal(t, "memory-article-2", a.Slug)
+	})
+
+	t.Run("should return ErrNotFound for missing author", func(t *testing.T) {
+		_, err := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "orphan", AuthorID: sql.NullInt32{Int32: 1000, Valid: true}}})
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound but got %v", err)
+	})
+
+	t.Run("should return ErrNotFound for missing slug", func(t *testing.T) {
+		_, err := store.GetArticle(context.Background(), "missing")
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound but got %v", err)
+	})
+
+	t.Run("should find renamed article by retired slug", func(t *testing.T) {
+		a, _ := store.GetArticle(context.Background(), "memory-article")
+		a.Title = "renamed memory article"
+		updated, err := store.UpdateArticle(context.Background(), a)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article to be updated without error but got %q", err))
+		assert.Equal(t, "renamed-memory-article", updated.Slug)
+
+		found, err := store.GetArticle(context.Background(), "memory-article")
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find article by retired slug but got %q", err))
+		assert.Equal(t, updated, found)
+
+		a.Title = "memory article"
+		a.Version = updated.Version
+		restored, err := store.UpdateArticle(context.Background(), a)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article to get its retired slug back but got %q", err))
+		assert.Equal(t, "memory-article", restored.Slug)
+	})
+
+	t.Run("should reflect author changes in articles", func(t *testing.T) {
+		renamed := author
+		renamed.UserName = "renamed author"
+		_, err := store.UpdateUser(context.Background(), author.UserName, renamed)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected user to be updated without error but got %q", err))
+		a, _ := store.GetArticle(context.Background(), "memory-article")
+		assert.Equal(t, renamed.UserName, a.Author.UserName)
+	})
+}
+
+func TestInMemoryUsers(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	user, err := store.Registration(context.Background(), RequestUserData{CommonUserData: CommonUserData{UserName: "u1", Email: "e"}, Password: "p"})
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected user to be registered without error but got %q", err))
+	other, _ := store.Registration(context.Background(), RequestUserData{CommonUserData: CommonUserData{UserName: "u2"}})
+
+	t.Run("should assign unique ids", func(t *testing.T) {
+		assert.NotZero(t, user.ID)
+		assert.NotEqual(t, user.ID, other.ID)
+	})
+
+	t.Run("should return ErrAlreadyExists for duplicate username", func(t *testing.T) {
+		_, err := store.Registration(context.Background(), RequestUserData{CommonUserData: CommonUserData{UserName: "u1"}})
+		assert.True(t, errors.Is(err, ErrAlreadyExists), "expected ErrAlreadyExists but got %v", err)
+	})
+
+	t.Run("should return ErrAlreadyExists for rename to taken username", func(t *testing.T) {
+		data := user
+		data.UserName = other.UserName
+		_, err := store.UpdateUser(context.Background(), user.UserName, data)
+		assert.True(t, errors.Is(err, ErrAlreadyExists), "expected ErrAlreadyExists but got %v", err)
+	})
+
+	t.Run("should return ErrNotFound for missing user", func(t *testing.T) {
+		_, err := store.GetUser(context.Background(), "missing")
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound on get but got %v", err)
+		_, err = store.UpdateUser(context.Background(), "missing", user)
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound on update but got %v", err)
+	})
+
+	t.Run("should keep id on update", func(t *testing.T) {
+		data := user
+		data.ID = 0
+		data.Bio = "b"
+		updated, err := store.UpdateUser(context.Background(), user.UserName, data)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected user to be updated without error but got %q", err))
+		assert.Equal(t, user.ID, updated.ID)
+		found, _ := store.GetUser(context.Background(), user.UserName)
+		assert.Equal(t, updated, found)
+	})
+}
+
+func TestInMemoryTx(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	ctx := context.Background()
+
+	t.Run("should apply all operations on success", func(t *testing.T) {
+		err := store.InTx(ctx, func(tx BlogStore) error {
+			u, err := tx.Registration(ctx, RequestUserData{CommonUserData: CommonUserData{UserName: "committed"}})
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: "committed", AuthorID: sql.NullInt32{Int32: int32(u.ID), Valid: true}}})
+			return err
+		})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected transaction to succeed but got %q", err))
+		a, err := store.GetArticle(ctx, "committed")
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find article created in transaction but got %q", err))
+		assert.Equal(t, "committed", a.Author.UserName)
+	})
+
+	t.Run("should discard all operations on error", func(t *testing.T) {
+		err := store.InTx(ctx, func(tx BlogStore) error {
+			if _, err := tx.Registration(ctx, RequestUserData{CommonUserData: CommonUserData{UserName: "rolled back"}}); err != nil {
+				return err
+			}
+			_, err := tx.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: "orphan", AuthorID: sql.NullInt32{Int32: 1000, Valid: true}}})
+			return err
+		})
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound but got %v", err)
+		_, err = store.GetUser(ctx, "rolled back")
+		assert.True(t, errors.Is(err, ErrNotFound), "expected user to be rolled back but got %v", err)
+	})
+
+	t.Run("should restore renamed entities and their indexes on error", func(t *testing.T) {
+		before, _ := store.GetArticle(ctx, "committed")
+		err := store.InTx(ctx, func(tx BlogStore) error {
+			a, _ := tx.GetArticle(ctx, "committed")
+			a.Title = "renamed"
+			if _, err := tx.UpdateArticle(ctx, a); err != nil {
+				return err
+			}
+			u, _ := tx.GetUser(ctx, "committed")
+			u.UserName = "renamed"
+			if _, err := tx.UpdateUser(ctx, "committed", u); err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		assert.EqualError(t, err, "abort")
+		a, err := store.GetArticle(ctx, "committed")
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find article by restored slug but got %q", err))
+		assert.Equal(t, before, a)
+		_, err = store.GetArticle(ctx, "renamed")
+		assert.True(t, errors.Is(err, ErrNotFound), "expected new slug to be rolled back but got %v", err)
+		_, err = store.GetUser(ctx, "committed")
+		assert.NoError(t, err, "expected username to be restored")
+		_, err = store.GetUser(ctx, "renamed")
+		assert.True(t, errors.Is(err, ErrNotFound), "expected new username to be rolled back but got %v", err)
+	})
+}
+
+func TestInMemoryConcurrency(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	const workers = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.Registration(context.Background(), RequestUserData{CommonUserData: CommonUserData{UserName: "same"}})
+			errs <- err
+			_, err = store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "same article"}})
+			errs <- err
+			store.GetArticle(context.Background(), "same-article")
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	var registrationErrors, articleErrors int
+	for err := range errs {
+		if errors.Is(err, ErrAlreadyExists) {
+			registrationErrors++
+		} else if err != nil {
+			articleErrors++
+		}
+	}
+	assert.Equal(t, workers-1, registrationErrors, "expected only one registration of the same username to succeed")
+	assert.Equal(t, 0, articleErrors, "expected all articles with the same title to be created")
+	assert.Len(t, store.state.articles, workers)
+	slugs := map[string]bool{}
+	for _, a := range store.state.articles {
+		slugs[a.Slug] = true
+	}
+	assert.Len(t, slugs, workers, "expected all articles to have unique slugs")
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationsLockID is key of postgres advisory lock which serializes concurrent migrations
+const migrationsLockID = 7454001
+
+// Migration is versioned db schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes if migration is applied to db
+type MigrationStatus struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+// Migrations returns migrations of the sql dialect embedded into binary sorted by version
+func Migrations(dialect string) ([]Migration, error) {
+	return loadMigrations(migrationFiles, path.Join("migrations", dialect))
+}
+
+// MigrateUp applies all pending migrations and returns applied ones
+func (s *DBBlogStore) MigrateUp() (applied []Migration, e error) {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return nil, e
+	}
+	migrations, e := Migrations(s.db.DriverName())
+	if e != nil {
+		return nil, e
+	}
+	if e = s.createMigrationsTable(); e != nil {
+		return nil, e
+	}
+	for _, m := range migrations {
+		var isApplied bool
+		e = s.inMigrationTx(func(tx *sqlx.Tx) (err error) {
+			if isApplied, err = isMigrationApplied(tx, m.Version); err != nil || isApplied {
+				return
+			}
+			if _, err = tx.Exec(m.Up); err != nil {
+				return fmt.Errorf("could not apply migration %d %q: %v", m.Version, m.Name, err)
+			}
+			_, err = tx.Exec(tx.Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), m.Version, m.Name)
+			return
+		})
+		if e != nil {
+			return applied, e
+		}
+		if !isApplied {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts given number of last applied migrations and returns reverted ones
+func (s *DBBlogStore) MigrateDown(steps int) (reverted []Migration, e error) {
+	statuses, e := s.MigrationStatus()
+	if e != nil {
+		return nil, e
+	}
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := statuses[i].Migration
+		if !statuses[i].AppliedAt.Valid {
+			continue
+		}
+		var isApplied bool
+		e = s.inMigrationTx(func(tx *sqlx.Tx) (err error) {
+			if isApplied, err = isMigrationApplied(tx, m.Version); err != nil || !isApplied {
+				return
+			}
+			if _, err = tx.Exec(m.Down); err != nil {
+				return fmt.Errorf("could not revert migration %d %q: %v", m.Version, m.Name, err)
+			}
+			_, err = tx.Exec(tx.Rebind("DELETE FROM schema_migrations WHERE version=?"), m.Version)
+			return
+		})
+		if e != nil {
+			return reverted, e
+		}
+		if isApplied {
+			reverted = append(reverted, m)
+		}
+	}
+	return reverted, nil
+}
+
+// MigrationStatus returns all known migrations with time they were applied at
+func (s *DBBlogStore) MigrationStatus() ([]MigrationStatus, error) {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return nil, e
+	}
+	migrations, e := Migrations(s.db.DriverName())
+	if e != nil {
+		return nil, e
+	}
+	if e = s.createMigrationsTable(); e != nil {
+		return nil, e
+	}
+	applied := []struct {
+		Version   int          `db:"version"`
+		AppliedAt sql.NullTime `db:"applied_at"`
+	}{}
+	if e = s.db.Select(&applied, "SELECT version, applied_at FROM schema_migrations"); e != nil {
+		return nil, e
+	}
+	appliedAt := map[int]sql.NullTime{}
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m, AppliedAt: appliedAt[m.Version]}
+	}
+	return statuses, nil
+}
+
+func (s *DBBlogStore) createMigrationsTable() error {
+	_, e := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+							version INTEGER PRIMARY KEY,
+							name TEXT NOT NULL,
+							applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+						)`)
+	return e
+}
+
+func (s *DBBlogStore) inMigrationTx(f func(tx *sqlx.Tx) error) (e error) {
+	tx, e := s.db.Beginx()
+	if e != nil {
+		return
+	}
+	defer func() {
+		if e != nil {
+			tx.Rollback()
+		} else {
+			e = tx.Commit()
+		}
+	}()
+	if s.db.DriverName() == DialectPostgres {
+		if _, e = tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationsLockID); e != nil {
+			return
+		}
+	}
+	return f(tx)
+}
+
+func isMigrationApplied(tx *sqlx.Tx, version int) (isApplied bool, e error) {
+	e = tx.Get(&isApplied, tx.Rebind("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version=?)"), version)
+	return
+}
+
+// loadMigrations reads migrations from dir. Files must be named as <version>_<name>.<up|down>.sql
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, e := fs.ReadDir(fsys, dir)
+	if e != nil {
+		return nil, e
+	}
+	byVersion := map[int]*Migration{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		version, name, direction, e := parseMigrationFileName(f.Name())
+		if e != nil {
+			return nil, e
+		}
+		content, e := fs.ReadFile(fsys, path.Join(dir, f.Name()))
+		if e != nil {
+			return nil, e
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d %q must have both up and down scripts", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func parseMigrationFileName(fileName string) (version int, name, direction string, e error) {
+	e = fmt.Errorf("invalid migration file name %q, expected <version>_<name>.<up|down>.sql", fileName)
+	parts := strings.Split(fileName, ".")
+	if len(parts) != 3 || parts[2] != "sql" || (parts[1] != "up" && parts[1] != "down") {
+		return
+	}
+	versionAndName := strings.SplitN(parts[0], "_", 2)
+	if len(versionAndName) != 2 || versionAndName[1] == "" {
+		return
+	}
+	if version, e = strconv.Atoi(versionAndName[0]); e != nil || version <= 0 {
+		e = fmt.Errorf("invalid migration version in file name %q", fileName)
+		return
+	}
+	return version, versionAndName[1], parts[1], nil
+}
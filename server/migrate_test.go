@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	postgresMigrations, err := Migrations(DialectPostgres)
+	failOnNotEqual(t, err, nil, "expected embedded postgres migrations to be loaded without errors")
+	failOnEqual(t, 0, len(postgresMigrations), "expected to find embedded postgres migrations")
+	for i := 1; i < len(postgresMigrations); i++ {
+		assert.Less(t, postgresMigrations[i-1].Version, postgresMigrations[i].Version, "expected migrations to be sorted by version")
+	}
+
+	sqliteMigrations, err := Migrations(DialectSQLite)
+	failOnNotEqual(t, err, nil, "expected embedded sqlite migrations to be loaded without errors")
+	failOnNotEqual(t, len(postgresMigrations), len(sqliteMigrations), "expected the same number of migrations for every dialect")
+	for i := range postgresMigrations {
+		assert.Equal(t, postgresMigrations[i].Version, sqliteMigrations[i].Version, "expected the same migration versions for every dialect")
+		assert.Equal(t, postgresMigrations[i].Name, sqliteMigrations[i].Name, "expected the same migration names for every dialect")
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := initSQLiteDB(t, false)
+	defer closeDB(t, db)
+
+	applied, err := db.MigrateUp()
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected migrations to be applied without errors but got %q", err))
+	all, _ := Migrations(DialectSQLite)
+	assert.Equal(t, all, applied, "expected all migrations to be applied")
+
+	applied, err = db.MigrateUp()
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected second migrate up to succeed but got %q", err))
+	assert.Empty(t, applied, "expected no migrations to be applied twice")
+
+	reverted, err := db.MigrateDown(1)
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected last migration to be reverted without errors but got %q", err))
+	assert.Equal(t, []Migration{all[len(all)-1]}, reverted)
+
+	statuses, err := db.MigrationStatus()
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected to get migration status without errors but got %q", err))
+	for i, s := range statuses {
+		assert.Equal(t, i < len(all)-1, s.AppliedAt.Valid, "unexpected applied state of migration %d", s.Version)
+	}
+
+	_, err = db.MigrateDown(len(all))
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected all migrations to be reverted without errors but got %q", err))
+	_, err = db.GetUser(context.Background(), "any")
+	assert.Error(t, err, "expected tables to be dropped")
+}
+
+func TestMigrateUpWithData(t *testing.T) {
+	db := initSQLiteDB(t, false)
+	defer closeDB(t, db)
+	all, _ := Migrations(DialectSQLite)
+	_, err := db.MigrateUp()
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected migrations to be applied without errors but got %q", err))
+	_, err = db.MigrateDown(len(all) - 1)
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected migrations to be reverted to the first one but got %q", err))
+	_, err = db.db.Exec("INSERT INTO usr (login) VALUES ('author')")
+	failOnNotEqual(t, err, nil, fmt.Sprintf("could not insert user %q", err))
+	_, err = db.db.Exec("INSERT INTO article (slug, title, author_id) VALUES ('old-article', 'Old article', 1)")
+	failOnNotEqual(t, err, nil, fmt.Sprintf("could not insert article %q", err))
+
+	_, err = db.MigrateUp()
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected migrations to be applied to db with data but got %q", err))
+	a, err := db.GetArticle(context.Background(), "old-article")
+	failOnNotEqual(t, err, nil, fmt.Sprintf("expected migrated article to be found but got %q", err))
+	assert.Equal(t, "Old article", a.Title)
+	assert.Equal(t, "author", a.Author.UserName)
+	assert.False(t, a.CreatedAt.IsZero(), "expected migrated article to get creation time")
+	assert.Equal(t, 1, a.Version)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("should pair up and down scripts and sort by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/0002_second.up.sql":   {Data: []byte("up 2")},
+			"m/0002_second.down.sql": {Data: []byte("down 2")},
+			"m/0001_first.down.sql":  {Data: []byte("down 1")},
+			"m/0001_first.up.sql":    {Data: []byte("up 1")},
+		}
+		migrations, err := loadMigrations(fsys, "m")
+		failOnNotEqual(t, err, nil, "expected migrations to be loaded without errors")
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+			{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+		}, migrations)
+	})
+
+	t.Run("should return error for invalid migration sets", func(t *testing.T) {
+		testCases := map[string]fstest.MapFS{
+			"missing down script": {
+				"m/0001_first.up.sql": {Data: []byte("up 1")},
+			},
+			"duplicate version": {
+				"m/0001_first.up.sql":    {Data: []byte("up 1")},
+				"m/0001_first.down.sql":  {Data: []byte("down 1")},
+				"m/0001_second.up.sql":   {Data: []byte("up 2")},
+				"m/0001_second.down.sql": {Data: []byte("down 2")},
+			},
+			"invalid file name": {
+				"m/first.up.sql": {Data: []byte("up 1")},
+			},
+			"invalid direction": {
+				"m/0001_first.sideways.sql": {Data: []byte("up 1")},
+			},
+		}
+		for name, fsys := range testCases {
+			_, err := loadMigrations(fsys, "m")
+			assert.Error(t, err, "expected error for %s", name)
+		}
+	})
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS article;
+DROP TABLE IF EXISTS usr;
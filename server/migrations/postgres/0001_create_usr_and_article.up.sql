@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS usr (
+    id SERIAL PRIMARY KEY,
+    login TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    bio TEXT NOT NULL DEFAULT '',
+    image TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS article (
+    id SERIAL PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL,
+    author_id INTEGER REFERENCES usr (id) ON DELETE SET NULL
+);
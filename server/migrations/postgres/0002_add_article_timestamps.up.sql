@@ -0,0 +1,2 @@
+ALTER TABLE article ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE article ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
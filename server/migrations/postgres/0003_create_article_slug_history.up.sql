@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS article_slug_history (
+    slug TEXT PRIMARY KEY,
+    article_id INTEGER NOT NULL REFERENCES article (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS article_slug_history_article_id_idx ON article_slug_history (article_id);
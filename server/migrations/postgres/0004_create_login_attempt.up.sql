@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS login_attempt (
+    login TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ
+);
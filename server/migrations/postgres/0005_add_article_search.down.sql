@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS article_search_idx;
+ALTER TABLE article DROP COLUMN search;
+ALTER TABLE article DROP COLUMN body;
+ALTER TABLE article DROP COLUMN description;
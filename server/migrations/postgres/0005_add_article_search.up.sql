@@ -0,0 +1,9 @@
+ALTER TABLE article ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE article ADD COLUMN body TEXT NOT NULL DEFAULT '';
+ALTER TABLE article ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', description), 'B') ||
+    setweight(to_tsvector('english', body), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS article_search_idx ON article USING GIN (search);
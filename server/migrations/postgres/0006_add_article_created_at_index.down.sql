@@ -0,0 +1 @@
+DROP INDEX IF EXISTS article_created_at_id_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS article_created_at_id_idx ON article (created_at, id);
@@ -0,0 +1,2 @@
+ALTER TABLE usr DROP COLUMN version;
+ALTER TABLE article DROP COLUMN version;
@@ -0,0 +1,2 @@
+ALTER TABLE article ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE usr ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
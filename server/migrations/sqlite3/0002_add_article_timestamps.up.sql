@@ -0,0 +1,15 @@
+-- SQLite can't add columns with non-constant default to tables with rows, so article table is rebuilt
+CREATE TABLE article_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL,
+    author_id INTEGER REFERENCES usr (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+INSERT INTO article_new (id, slug, title, author_id) SELECT id, slug, title, author_id FROM article;
+
+DROP TABLE article;
+
+ALTER TABLE article_new RENAME TO article;
@@ -0,0 +1,2 @@
+ALTER TABLE article DROP COLUMN body;
+ALTER TABLE article DROP COLUMN description;
@@ -0,0 +1,2 @@
+ALTER TABLE article ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE article ADD COLUMN body TEXT NOT NULL DEFAULT '';
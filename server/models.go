@@ -3,6 +3,7 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -23,6 +24,10 @@ type UnprocessableEntityResponse struct {
 	Errors UnprocessableEntityError
 }
 
+func newUnprocessableEntityResponse(errors ...string) *UnprocessableEntityResponse {
+	return &UnprocessableEntityResponse{Errors: UnprocessableEntityError{Body: errors}}
+}
+
 func (e *UnprocessableEntityResponse) Error() string {
 	b, _ := json.Marshal(e)
 	return string(b)
@@ -35,11 +40,12 @@ type UnprocessableEntityError struct {
 
 // CommonUserData represents user data that is common for user request and response
 type CommonUserData struct {
-	ID       int    `db:"id"`
+	ID       int    `db:"id" json:"-"`
 	Email    string `db:"email"`
 	UserName string `db:"login"`
 	Bio      string `db:"bio"`
 	Image    string `db:"image"`
+	Version  int    `db:"version"`
 }
 
 // RequestUserData represents user request data
@@ -51,10 +57,12 @@ type RequestUserData struct {
 // ToCommonUserData converts current type to CommonUserData
 func (u *RequestUserData) ToCommonUserData() CommonUserData {
 	return CommonUserData{
+		ID:       u.ID,
 		Email:    u.Email,
 		UserName: u.UserName,
 		Bio:      u.Bio,
 		Image:    u.Image,
+		Version:  u.Version,
 	}
 }
 
@@ -90,6 +98,7 @@ type UpdateUserData struct {
 	Bio      *string
 	Image    *string
 	Password *string
+	Version  *int
 }
 
 // UpdateUserRequest is request model to update user
@@ -106,14 +115,74 @@ type Profile struct {
 
 // Article is model of the blog article
 type Article struct {
-	ID       int           `db:"id"`
-	Slug     string        `db:"slug"`
-	Title    string        `db:"title"`
-	AuthorID sql.NullInt32 `db:"author_id"`
-	Author   Profile
+	ID          int           `db:"id"`
+	Slug        string        `db:"slug"`
+	Title       string        `db:"title"`
+	Description string        `db:"description"`
+	Body        string        `db:"body"`
+	AuthorID    sql.NullInt32 `db:"author_id"`
+	Author      Profile
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	Version     int       `db:"version"`
 }
 
 // SingleArticleHTTPWrap is http request/response model for single article
 type SingleArticleHTTPWrap struct {
 	Article
 }
+
+// ArticleCursor is position in list of articles ordered by creation time and id
+type ArticleCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// Less reports if cursor is before other one in order of creation
+func (c ArticleCursor) Less(other ArticleCursor) bool {
+	return c.CreatedAt.Before(other.CreatedAt) || (c.CreatedAt.Equal(other.CreatedAt) && c.ID < other.ID)
+}
+
+// ArticleListQuery selects page of articles ordered from newest to oldest.
+// After selects articles older than cursor, Before selects articles newer than cursor
+type ArticleListQuery struct {
+	Limit  int
+	After  *ArticleCursor
+	Before *ArticleCursor
+}
+
+// ArticleListResponse is http response model for page of articles. Next and Prev are opaque cursors of adjacent pages
+type ArticleListResponse struct {
+	Articles []Article
+	Next     string `json:",omitempty"`
+	Prev     string `json:",omitempty"`
+}
+
+// ArticleSearchQuery is full-text search request for articles
+type ArticleSearchQuery struct {
+	Text   string
+	Limit  int
+	Offset int
+}
+
+// ArticleSearchHit is article found by search with its relevance and highlighted fragment of text
+type ArticleSearchHit struct {
+	Article
+	Rank    float64 `db:"rank"`
+	Snippet string  `db:"snippet"`
+}
+
+// ArticleSearchResult is page of search hits ordered by relevance
+type ArticleSearchResult struct {
+	Articles []ArticleSearchHit
+	Total    int
+	Limit    int
+	Offset   int
+}
+
+// LoginAttempts is failed login attempts of username. Username may not belong to any user
+type LoginAttempts struct {
+	Login       string       `db:"login"`
+	Failures    int          `db:"failures"`
+	LockedUntil sql.NullTime `db:"locked_until"`
+}
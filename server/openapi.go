@@ -0,0 +1,451 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// OpenAPIPath is path of OpenAPI 3 document describing the API
+const OpenAPIPath = "/api/openapi.json"
+
+// tokenSecurityScheme is name of security scheme for "Token <jwt>" Authorization header
+const tokenSecurityScheme = "Token"
+
+// openAPIDocument is OpenAPI 3 document. Only parts of the specification used by the API are modeled
+type openAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// openAPIPathItem is operations of path by lower case http method
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string         `json:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// openAPIDoc is document served by the API. It is built once since it depends only on routes and models
+var openAPIDoc = newOpenAPIDocument()
+
+func (s *BlogServer) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeCacheableJSONResponse(w, r, openAPIDoc, cacheControlPublic)
+}
+
+// openAPIRoute returns route of getRoutes which serves OpenAPI path. Path parameter at the end is served by route prefix
+func openAPIRoute(path string) string {
+	if i := strings.IndexByte(path, '{'); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// newOpenAPIDocument describes every route of the server. Schemas of request and response bodies are derived from models
+func newOpenAPIDocument() openAPIDocument {
+	schemas := openAPISchemas{}
+	auth := []map[string][]string{{tokenSecurityScheme: {}}}
+	article := schemas.response(SingleArticleHTTPWrap{})
+	user := schemas.response(ResponseUser{})
+	articleBody := schemas.request(SingleArticleHTTPWrap{}, "Title")
+	withETag := map[string]openAPIHeader{
+		HeaderKeyETag:         {Description: "strong ETag of the representation", Schema: &openAPISchema{Type: "string"}},
+		HeaderKeyCacheControl: {Schema: &openAPISchema{Type: "string"}},
+	}
+	updatedETag := map[string]openAPIHeader{HeaderKeyETag: withETag[HeaderKeyETag]}
+	slug := openAPIParameter{Name: "slug", In: "path", Required: true, Schema: &openAPISchema{Type: "string"}}
+	ifNoneMatch := openAPIParameter{Name: HeaderKeyIfNoneMatch, In: "header", Description: "ETag of cached representation", Schema: &openAPISchema{Type: "string"}}
+	ifMatch := openAPIParameter{Name: HeaderKeyIfMatch, In: "header", Description: "ETag of changed representation, required unless Version is in body", Schema: &openAPISchema{Type: "string"}}
+	limit := openAPIParameter{Name: "limit", In: "query", Description: "page size", Schema: &openAPISchema{Type: "integer", Minimum: openAPIBound(1), Maximum: openAPIBound(MaxPageLimit)}}
+
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "go-rest-api", Version: "1.0.0"},
+		Paths: map[string]openAPIPathItem{
+			"/api/articles": {
+				"get": {
+					OperationID: "listArticles",
+					Summary:     "List articles from newest to oldest",
+					Parameters: []openAPIParameter{limit, {
+						Name: "cursor", In: "query", Description: "Next or Prev cursor of previous page", Schema: &openAPISchema{Type: "string"},
+					}},
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("page of articles", schemas.response(ArticleListResponse{})),
+						"422": schemas.errorResponse("invalid limit or cursor"),
+					},
+				},
+				"post": {
+					OperationID: "createArticle",
+					Summary:     "Create article of current user",
+					RequestBody: jsonRequestBody(articleBody),
+					Security:    auth,
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("created article", schemas.response(Article{})),
+						"401": unauthorizedResponse(),
+						"422": schemas.errorResponse("invalid article or article with such title already exists"),
+						"429": schemas.tooManyRequestsResponse(),
+					},
+				},
+			},
+			ArticlesPath + "{slug}": {
+				"get": {
+					OperationID: "getArticle",
+					Summary:     "Get article by slug",
+					Parameters:  []openAPIParameter{slug, ifNoneMatch},
+					Responses: map[string]openAPIResponse{
+						"200": responseWithHeaders(jsonResponse("article", article), withETag),
+						"301": {Description: "article was renamed, Location is its current path", Headers: map[string]openAPIHeader{
+							HeaderKeyLocation: {Schema: &openAPISchema{Type: "string"}},
+						}},
+						"304": {Description: "article matches If-None-Match", Headers: withETag},
+						"404": {Description: "article not found"},
+					},
+				},
+				"put": {
+					OperationID: "updateArticle",
+					Summary:     "Update article of current user",
+					Parameters:  []openAPIParameter{slug, ifMatch},
+					RequestBody: jsonRequestBody(articleBody),
+					Security:    auth,
+					Responses: map[string]openAPIResponse{
+						"200": responseWithHeaders(jsonResponse("updated article", article), updatedETag),
+						"401": unauthorizedResponse(),
+						"403": {Description: "article belongs to other user or has no author"},
+						"404": {Description: "article not found"},
+						"412": schemas.errorResponse("article was changed since the version"),
+						"422": schemas.errorResponse("invalid article or article with such title already exists"),
+						"428": schemas.errorResponse("neither If-Match nor Version is sent"),
+						"429": schemas.tooManyRequestsResponse(),
+					},
+				},
+			},
+			ArticleSearchPath: {
+				"get": {
+					OperationID: "searchArticles",
+					Summary:     "Search articles by text ordered by relevance",
+					Parameters: []openAPIParameter{
+						{Name: "q", In: "query", Required: true, Description: "search text", Schema: &openAPISchema{Type: "string"}},
+						limit,
+						{Name: "offset", In: "query", Schema: &openAPISchema{Type: "integer", Minimum: openAPIBound(0)}},
+					},
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("page of found articles", schemas.response(ArticleSearchResult{})),
+						"422": schemas.errorResponse("missing search text or invalid paging"),
+					},
+				},
+			},
+			"/api/user": {
+				"get": {
+					OperationID: "getCurrentUser",
+					Summary:     "Get current user",
+					Parameters:  []openAPIParameter{ifNoneMatch},
+					Security:    auth,
+					Responses: map[string]openAPIResponse{
+						"200": responseWithHeaders(jsonResponse("current user", user), withETag),
+						"304": {Description: "user matches If-None-Match", Headers: withETag},
+						"401": unauthorizedResponse(),
+						"404": {Description: "user of token not found"},
+					},
+				},
+				"put": {
+					OperationID: "updateUser",
+					Summary:     "Update current user, fields missing in body are not changed",
+					Parameters:  []openAPIParameter{ifMatch},
+					RequestBody: jsonRequestBody(schemas.request(UpdateUserRequest{}, "User")),
+					Security:    auth,
+					Responses: map[string]openAPIResponse{
+						"200": responseWithHeaders(jsonResponse("updated user with new token", user), updatedETag),
+						"401": unauthorizedResponse(),
+						"404": {Description: "user of token not found"},
+						"412": schemas.errorResponse("user was changed since the version"),
+						"422": schemas.errorResponse("invalid body or user with such username already exists"),
+						"428": schemas.errorResponse("neither If-Match nor Version is sent"),
+						"429": schemas.tooManyRequestsResponse(),
+					},
+				},
+			},
+			"/api/users/login": {
+				"post": {
+					OperationID: "login",
+					Summary:     "Get auth token by username and password",
+					RequestBody: jsonRequestBody(schemas.request(RequestUser{}, "User.UserName", "User.Password")),
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("authenticated user with token", user),
+						"404": {Description: "wrong username or password"},
+						"422": schemas.errorResponse("invalid body"),
+						"423": responseWithHeaders(schemas.errorResponse("username is locked after failed logins"), retryAfter()),
+						"429": schemas.tooManyRequestsResponse(),
+					},
+				},
+			},
+			"/api/users": {
+				"post": {
+					OperationID: "register",
+					Summary:     "Register user",
+					RequestBody: jsonRequestBody(schemas.request(RequestUser{}, "User.UserName", "User.Email", "User.Password")),
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("registered user with token", user),
+						"422": schemas.errorResponse("invalid body or user with such username already exists"),
+						"429": schemas.tooManyRequestsResponse(),
+					},
+				},
+			},
+			"/healthz": {
+				"get": {
+					OperationID: "liveness",
+					Summary:     "Liveness probe",
+					Responses:   map[string]openAPIResponse{"200": jsonResponse("server is alive", schemas.response(HealthStatus{}))},
+				},
+			},
+			"/readyz": {
+				"get": {
+					OperationID: "readiness",
+					Summary:     "Readiness probe",
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("server is ready", schemas.response(HealthStatus{})),
+						"503": jsonResponse("server is draining or db is unavailable", schemas.response(HealthStatus{})),
+					},
+				},
+			},
+			"/metrics": {
+				"get": {
+					OperationID: "metrics",
+					Summary:     "Values of registered metrics by name",
+					Responses: map[string]openAPIResponse{
+						"200": jsonResponse("metrics", &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{}}),
+					},
+				},
+			},
+			OpenAPIPath: {
+				"get": {
+					OperationID: "openAPI",
+					Summary:     "This document",
+					Parameters:  []openAPIParameter{ifNoneMatch},
+					Responses: map[string]openAPIResponse{
+						"200": responseWithHeaders(jsonResponse("OpenAPI 3 document", &openAPISchema{Type: "object"}), withETag),
+						"304": {Description: "document matches If-None-Match", Headers: withETag},
+					},
+				},
+			},
+		},
+		Components: openAPIComponents{
+			Schemas: schemas,
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				tokenSecurityScheme: {Type: "apiKey", In: "header", Name: HeaderKeyAuthorization, Description: AuthHeader0Part + " <jwt>"},
+			},
+		},
+	}
+	for path, item := range doc.Paths {
+		if !strings.HasPrefix(path, "/api/") || path == OpenAPIPath {
+			continue
+		}
+		for _, op := range item {
+			op.Responses["500"] = openAPIResponse{Description: "unexpected store error"}
+			op.Responses["503"] = openAPIResponse{Description: "store timed out", Headers: retryAfter()}
+		}
+	}
+	return doc
+}
+
+func jsonResponse(description string, schema *openAPISchema) openAPIResponse {
+	return openAPIResponse{Description: description, Content: map[string]openAPIMediaType{"application/json": {Schema: schema}}}
+}
+
+func jsonRequestBody(schema *openAPISchema) *openAPIRequestBody {
+	return &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{"application/json": {Schema: schema}}}
+}
+
+func responseWithHeaders(r openAPIResponse, headers map[string]openAPIHeader) openAPIResponse {
+	r.Headers = headers
+	return r
+}
+
+func unauthorizedResponse() openAPIResponse {
+	return openAPIResponse{Description: "missing or invalid auth token"}
+}
+
+func retryAfter() map[string]openAPIHeader {
+	return map[string]openAPIHeader{HeaderKeyRetryAfter: {Description: "seconds to wait", Schema: &openAPISchema{Type: "integer"}}}
+}
+
+func openAPIBound(v float64) *float64 {
+	return &v
+}
+
+// openAPISchemas are component schemas of response models by type name
+type openAPISchemas map[string]*openAPISchema
+
+func (s openAPISchemas) errorResponse(description string) openAPIResponse {
+	return jsonResponse(description, s.response(UnprocessableEntityResponse{}))
+}
+
+func (s openAPISchemas) tooManyRequestsResponse() openAPIResponse {
+	return responseWithHeaders(s.errorResponse("too many requests"), retryAfter())
+}
+
+// response returns reference to component schema of response model. Fields which are always encoded are required
+func (s openAPISchemas) response(v interface{}) *openAPISchema {
+	return s.schemaOf(reflect.TypeOf(v), true)
+}
+
+// request returns inline schema of request model. Go decoder accepts missing fields, so only the listed dotted paths are required
+func (s openAPISchemas) request(v interface{}, required ...string) *openAPISchema {
+	schema := s.schemaOf(reflect.TypeOf(v), false)
+	for _, path := range required {
+		parent := schema
+		names := strings.Split(path, ".")
+		for _, name := range names[:len(names)-1] {
+			parent.Required = appendMissing(parent.Required, name)
+			parent = parent.Properties[name]
+		}
+		parent.Required = appendMissing(parent.Required, names[len(names)-1])
+	}
+	return schema
+}
+
+// schemaOf returns schema of json encoding of t. Named structs of responses are components referenced by name
+func (s openAPISchemas) schemaOf(t reflect.Type, response bool) *openAPISchema {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Ptr:
+		schema := s.schemaOf(t.Elem(), response)
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case t.Kind() == reflect.Struct && response && t.Name() != "":
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = &openAPISchema{}
+			*s[t.Name()] = *s.structSchema(t, response)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Struct:
+		return s.structSchema(t, response)
+	case t.Kind() == reflect.Slice:
+		return &openAPISchema{Type: "array", Nullable: true, Items: s.schemaOf(t.Elem(), response)}
+	case t.Kind() == reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem(), response)}
+	case t.Kind() == reflect.String:
+		return &openAPISchema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema := &openAPISchema{Type: "integer"}
+		if t.Bits() == 32 {
+			schema.Format = "int32"
+		}
+		return schema
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	}
+	return &openAPISchema{}
+}
+
+// structSchema returns object schema with fields of t named as encoding/json does. Embedded structs are flattened
+func (s openAPISchemas) structSchema(t reflect.Type, response bool) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, options = tag[:i], tag[i:]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := s.structSchema(f.Type, response)
+			for n, p := range embedded.Properties {
+				schema.Properties[n] = p
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema.Properties[name] = s.schemaOf(f.Type, response)
+		if response && !strings.Contains(options, ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// appendMissing appends name to names unless it is already there
+func appendMissing(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
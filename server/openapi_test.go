@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	t.Run("should describe every route and only them", func(t *testing.T) {
+		routes := []string{}
+		for r, handlers := range (&BlogServer{}).getRoutes() {
+			for method := range handlers {
+				routes = append(routes, method+" "+r)
+			}
+		}
+		documented := []string{}
+		for path, item := range openAPIDoc.Paths {
+			for method := range item {
+				documented = append(documented, strings.ToUpper(method)+" "+openAPIRoute(path))
+			}
+		}
+		sort.Strings(routes)
+		sort.Strings(documented)
+		assert.Equal(t, routes, documented, "routes and OpenAPI paths drifted apart")
+	})
+
+	t.Run("should reference only defined schemas", func(t *testing.T) {
+		b, _ := json.Marshal(openAPIDoc)
+		var doc interface{}
+		json.Unmarshal(b, &doc)
+		walkJSON(doc, func(key string, v interface{}) {
+			if ref, ok := v.(string); ok && key == "$ref" {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				assert.Contains(t, openAPIDoc.Components.Schemas, name, "for $ref %s", ref)
+			}
+		})
+	})
+
+	t.Run("should derive schemas from models", func(t *testing.T) {
+		article := openAPIDoc.Components.Schemas["SingleArticleHTTPWrap"]
+		if !assert.NotNil(t, article, "expected article schema") {
+			return
+		}
+		assert.Equal(t, "string", article.Properties["Slug"].Type)
+		assert.Equal(t, "date-time", article.Properties["CreatedAt"].Format)
+		assert.Contains(t, article.Required, "Version")
+		page := openAPIDoc.Components.Schemas["ArticleListResponse"]
+		assert.NotContains(t, page.Required, "Next", "expected omitempty field to be optional")
+		user := openAPIDoc.Components.Schemas["ResponseUserData"]
+		assert.Contains(t, user.Properties, "Token")
+		assert.NotContains(t, user.Properties, "Password")
+	})
+
+	t.Run("should require token for routes with auth", func(t *testing.T) {
+		for path, item := range openAPIDoc.Paths {
+			for method, op := range item {
+				_, unauthorized := op.Responses["401"]
+				assert.Equal(t, unauthorized, len(op.Security) > 0, "for %s %s", method, path)
+			}
+		}
+	})
+}
+
+func TestRouteMethods(t *testing.T) {
+	server := newContractServer(t, &StubBlogStore{})
+
+	t.Run("should return 404 for methods without handler", func(t *testing.T) {
+		for _, r := range []struct{ method, path string }{
+			{http.MethodGet, "/api/users/login"},
+			{http.MethodGet, "/api/users"},
+			{http.MethodDelete, ArticlesPath + "some-art"},
+			{http.MethodPost, "/healthz"},
+			{http.MethodPut, OpenAPIPath},
+		} {
+			req, _ := http.NewRequest(r.method, r.path, nil)
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusNotFound, resp.Code, "for %s %s", r.method, r.path)
+		}
+	})
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	server := newContractServer(t, &StubBlogStore{})
+	req, _ := http.NewRequest(http.MethodGet, OpenAPIPath, nil)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	var doc openAPIDocument
+	assertSussessJSONResponse(t, resp, &doc)
+	assert.Equal(t, openAPIDoc, doc)
+	assert.NotEmpty(t, resp.Header().Get(HeaderKeyETag))
+}
+
+// walkJSON calls f for every value of decoded json with key of the value in its object
+func walkJSON(v interface{}, f func(key string, v interface{})) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			f(key, child)
+			walkJSON(child, f)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkJSON(child, f)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+// ServerOption configures optional blog server features
+type ServerOption func(*serverOptions)
+
+// serverOptions are optional features applied by NewBlogServer
+type serverOptions struct {
+	cors        *CORSOptions
+	compression *CompressionOptions
+	rateLimits  RateLimits
+	lockout     LockoutPolicy
+	metrics     map[string]func() interface{}
+}
+
+// WithMetrics adds metric reported by /metrics route. Value of the metric is encoded to json on every request
+func WithMetrics(name string, value func() interface{}) ServerOption {
+	return func(s *serverOptions) {
+		if s.metrics == nil {
+			s.metrics = map[string]func() interface{}{}
+		}
+		s.metrics[name] = value
+	}
+}
+
+func newServerOptions(opts []ServerOption) serverOptions {
+	o := serverOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
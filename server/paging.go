@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Paging limits of list endpoints
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Directions of page cursors
+const (
+	cursorAfter  = 'a'
+	cursorBefore = 'b'
+)
+
+// errInvalidCursor is returned for cursors which are malformed or signed with other key
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor points to position in list of articles ordered from newest to oldest.
+// Page after cursor has older articles, page before it has newer ones
+type pageCursor struct {
+	ArticleCursor
+	before bool
+}
+
+// parsePageLimit reads limit param. Missing limit is DefaultPageLimit
+func parsePageLimit(params url.Values) (int, error) {
+	v := params.Get("limit")
+	if v == "" {
+		return DefaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err == nil && (limit < 1 || limit > MaxPageLimit) {
+		err = fmt.Errorf("limit %d is out of range [1, %d]", limit, MaxPageLimit)
+	}
+	return limit, err
+}
+
+// encodeCursor returns opaque cursor signed with key derived from auth secret, so clients can't forge positions
+func encodeCursor(c pageCursor) string {
+	direction := cursorAfter
+	if c.before {
+		direction = cursorBefore
+	}
+	payload := fmt.Sprintf("%c%d.%d", direction, c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(signCursor(payload))
+}
+
+// decodeCursor parses cursor made by encodeCursor
+func decodeCursor(s string) (c pageCursor, e error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return c, errInvalidCursor
+	}
+	payload, e1 := base64.RawURLEncoding.DecodeString(parts[0])
+	signature, e2 := base64.RawURLEncoding.DecodeString(parts[1])
+	if e1 != nil || e2 != nil || len(payload) == 0 || !hmac.Equal(signature, signCursor(string(payload))) {
+		return c, errInvalidCursor
+	}
+	switch payload[0] {
+	case cursorAfter:
+	case cursorBefore:
+		c.before = true
+	default:
+		return c, errInvalidCursor
+	}
+	fields := strings.Split(string(payload[1:]), ".")
+	if len(fields) != 2 {
+		return c, errInvalidCursor
+	}
+	nanos, e1 := strconv.ParseInt(fields[0], 10, 64)
+	id, e2 := strconv.Atoi(fields[1])
+	if e1 != nil || e2 != nil {
+		return c, errInvalidCursor
+	}
+	c.CreatedAt = time.Unix(0, nanos).UTC()
+	c.ID = id
+	return c, nil
+}
+
+func signCursor(payload string) []byte {
+	mac := hmac.New(sha256.New, cursorKey())
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// cursorKey derives cursor signing key from auth secret, so cursor signatures are never valid as token signatures
+func cursorKey() []byte {
+	mac := hmac.New(sha256.New, []byte(authSecretKey))
+	mac.Write([]byte("cursor"))
+	return mac.Sum(nil)
+}
+
+// cursorOf returns cursor of article position in the list
+func cursorOf(a Article, before bool) string {
+	return encodeCursor(pageCursor{ArticleCursor: ArticleCursor{CreatedAt: a.CreatedAt, ID: a.ID}, before: before})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageCursor(t *testing.T) {
+	c := pageCursor{ArticleCursor: ArticleCursor{CreatedAt: time.Date(2020, 5, 1, 10, 0, 0, 123456000, time.UTC), ID: 42}, before: true}
+
+	t.Run("should decode encoded cursor", func(t *testing.T) {
+		decoded, err := decodeCursor(encodeCursor(c))
+		assert.NoError(t, err)
+		assert.Equal(t, c, decoded)
+	})
+
+	t.Run("should reject forged and malformed cursors", func(t *testing.T) {
+		encoded := encodeCursor(c)
+		payload := encoded[:strings.IndexByte(encoded, '.')]
+		for _, s := range []string{"", "abc", payload, payload + ".AAAA", "a" + encoded, encoded + "."} {
+			_, err := decodeCursor(s)
+			assert.Equal(t, errInvalidCursor, err, "for cursor %q", s)
+		}
+	})
+
+	t.Run("should not sign cursors with auth secret itself", func(t *testing.T) {
+		encoded := encodeCursor(c)
+		payload, _ := base64.RawURLEncoding.DecodeString(encoded[:strings.IndexByte(encoded, '.')])
+		mac := hmac.New(sha256.New, []byte(authSecretKey))
+		mac.Write(payload)
+		signed := encoded[:strings.IndexByte(encoded, '.')+1] + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+		_, err := decodeCursor(signed)
+		assert.Equal(t, errInvalidCursor, err)
+	})
+}
+
+func TestListArticles(t *testing.T) {
+	store := NewInMemoryBlogStore()
+	for i := 0; i < 5; i++ {
+		store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: fmt.Sprintf("article %d", i)}})
+	}
+	server := newContractServer(t, store)
+	list := func(t *testing.T, params url.Values) ArticleListResponse {
+		t.Helper()
+		req, resp := makeListArticlesRequestSuite(params)
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for list of articles")
+		var page ArticleListResponse
+		failOnNotEqual(t, json.NewDecoder(resp.Body).Decode(&page), nil, "could not decode page of articles")
+		return page
+	}
+	slugs := func(page ArticleListResponse) []string {
+		s := []string{}
+		for _, a := range page.Articles {
+			s = append(s, a.Slug)
+		}
+		return s
+	}
+
+	t.Run("should walk pages with next and prev cursors", func(t *testing.T) {
+		first := list(t, url.Values{"limit": {"2"}})
+		assert.Equal(t, []string{"article-4", "article-3"}, slugs(first))
+		assert.Empty(t, first.Prev, "expected no previous page for the first one")
+
+		second := list(t, url.Values{"limit": {"2"}, "cursor": {first.Next}})
+		assert.Equal(t, []string{"article-2", "article-1"}, slugs(second))
+
+		last := list(t, url.Values{"limit": {"2"}, "cursor": {second.Next}})
+		assert.Equal(t, []string{"article-0"}, slugs(last))
+		assert.Empty(t, last.Next, "expected no next page for the last one")
+
+		back := list(t, url.Values{"limit": {"2"}, "cursor": {last.Prev}})
+		assert.Equal(t, slugs(second), slugs(back))
+		assert.Equal(t, second.Next, back.Next)
+
+		back = list(t, url.Values{"limit": {"2"}, "cursor": {back.Prev}})
+		assert.Equal(t, slugs(first), slugs(back))
+		assert.Empty(t, back.Prev, "expected no previous page for the first one")
+	})
+
+	t.Run("should return 422 for invalid params", func(t *testing.T) {
+		for _, params := range []url.Values{{"limit": {"0"}}, {"limit": {"1000"}}, {"cursor": {"forged"}}} {
+			req, resp := makeListArticlesRequestSuite(params)
+			server.ServeHTTP(resp, req)
+			assertStatus(t, http.StatusUnprocessableEntity, resp.Code, "for params "+params.Encode())
+		}
+	})
+
+	t.Run("should not require auth for list", func(t *testing.T) {
+		req, resp := makeListArticlesRequestSuite(url.Values{})
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for list without token")
+	})
+}
+
+func makeListArticlesRequestSuite(params url.Values) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodGet, "/api/articles?"+params.Encode(), nil)
+	return req, httptest.NewRecorder()
+}
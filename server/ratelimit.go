@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits rate of events per key. Implementations may keep buckets in a store shared by server instances
+type RateLimiter interface {
+	// Allow takes a token from bucket of every key if all of them have one. Otherwise no tokens are taken
+	// and it returns false and time until every bucket has a token
+	Allow(ctx context.Context, keys ...string) (bool, time.Duration, error)
+}
+
+// RateLimits are limiters of requests. Nil limiter disables the limit
+type RateLimits struct {
+	// Auth limits login and registration attempts per client ip and per username
+	Auth RateLimiter
+	// Write limits write requests per authenticated user
+	Write RateLimiter
+	// TrustedProxies are networks of reverse proxies. Client ip of requests coming from them is taken
+	// from X-Forwarded-For or X-Real-IP header, other requests use ip of the connection
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies parses list of proxy ips and CIDR networks
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, e := net.ParseCIDR(p)
+		if e != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// WithRateLimits enables rate limiting of requests. Limited requests get 429 response with Retry-After header
+func WithRateLimits(l RateLimits) ServerOption {
+	return func(s *serverOptions) {
+		s.rateLimits = l
+	}
+}
+
+// Rate limiter key prefixes
+const (
+	rateKeyAuthIP   = "auth-ip:"
+	rateKeyAuthUser = "auth-user:"
+	rateKeyWrite    = "write:"
+)
+
+// tokenBucketSweepInterval is how often full buckets are removed from memory
+const tokenBucketSweepInterval = time.Minute
+
+// TokenBucketLimiter is concurrency safe in memory RateLimiter. Every key has a bucket of limit tokens
+// which are restored evenly during period
+type TokenBucketLimiter struct {
+	limit     float64
+	period    time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewTokenBucketLimiter initializes limiter which allows burst of limit events restored during period
+func NewTokenBucketLimiter(limit int, period time.Duration) *TokenBucketLimiter {
+	return &TokenBucketLimiter{limit: float64(limit), period: period, now: time.Now, buckets: map[string]tokenBucket{}}
+}
+
+// Allow takes a token from bucket of every key if all of them have one
+func (l *TokenBucketLimiter) Allow(ctx context.Context, keys ...string) (bool, time.Duration, error) {
+	if e := contextError(ctx); e != nil {
+		return false, 0, e
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	buckets := make([]tokenBucket, len(keys))
+	var retryAfter time.Duration
+	for i, key := range keys {
+		buckets[i] = l.refill(key, now)
+		if wait := time.Duration(math.Ceil((1 - buckets[i].tokens) / l.rate())); buckets[i].tokens < 1 && wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	for i, key := range keys {
+		if retryAfter == 0 {
+			buckets[i].tokens--
+		}
+		l.buckets[key] = buckets[i]
+	}
+	return retryAfter == 0, retryAfter, nil
+}
+
+// refill returns bucket of the key with tokens restored since its last update
+func (l *TokenBucketLimiter) refill(key string, now time.Time) tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		return tokenBucket{tokens: l.limit, updated: now}
+	}
+	b.tokens = math.Min(l.limit, b.tokens+float64(now.Sub(b.updated))*l.rate())
+	b.updated = now
+	return b
+}
+
+// sweep removes buckets which are full by now, they are the same as missing ones
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < tokenBucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key := range l.buckets {
+		if l.refill(key, now).tokens >= l.limit {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rate returns number of tokens restored per nanosecond
+func (l *TokenBucketLimiter) rate() float64 {
+	return l.limit / float64(l.period)
+}
+
+// allowRequest checks all keys with limiter at once and writes error response if request is not allowed.
+// Request limited by one key doesn't use up limits of other keys
+func allowRequest(w http.ResponseWriter, r *http.Request, l RateLimiter, keys ...string) bool {
+	if l == nil {
+		return true
+	}
+	allowed, retryAfter, e := l.Allow(r.Context(), keys...)
+	if e != nil {
+		writeStoreError(w, e)
+		return false
+	}
+	if !allowed {
+		writeTooManyRequestsResponse(w, retryAfter)
+		return false
+	}
+	return true
+}
+
+// limitWrites wraps handler to limit write requests of authenticated users. Requests without valid token are not limited here
+func limitWrites(l RateLimiter, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+			if t, e := TokenFromAuthHeader(r); e == nil && t != "" {
+				if authData, e := ParseToken(t); e == nil && !allowRequest(w, r, l, rateKeyWrite+authData.Login) {
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authRateKeys returns keys to limit auth attempts by client ip and by username
+func authRateKeys(r *http.Request, trustedProxies []*net.IPNet, username string) []string {
+	return []string{rateKeyAuthIP + clientIP(r, trustedProxies), rateKeyAuthUser + username}
+}
+
+// clientIP returns ip of the client. Forwarding headers are read only from trusted proxies, X-Forwarded-For
+// is walked from the right and the first hop which is not a trusted proxy is the client
+func clientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, e := net.SplitHostPort(r.RemoteAddr); e == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+	if forwarded := r.Header.Values(HeaderKeyXForwardedFor); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !isTrustedProxy(hop, trustedProxies) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get(HeaderKeyXRealIP)); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// isTrustedProxy reports whether ip belongs to one of trusted proxy networks
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTooManyRequestsResponse(w http.ResponseWriter, retryAfter time.Duration) {
+	writeJSONContentType(w)
+	w.Header().Set(HeaderKeyRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(newUnprocessableEntityResponse(MsgTooManyRequests).Error()))
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// FailingRateLimiter fails every check like unreachable shared limiter store
+type FailingRateLimiter struct{}
+
+func (l FailingRateLimiter) Allow(ctx context.Context, keys ...string) (bool, time.Duration, error) {
+	return false, 0, errors.New("limiter store is down")
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	newLimiter := func() *TokenBucketLimiter {
+		l := NewTokenBucketLimiter(3, 3*time.Second)
+		l.now = func() time.Time { return now }
+		return l
+	}
+
+	t.Run("should allow burst and report time until the next token", func(t *testing.T) {
+		l := newLimiter()
+		for i := 0; i < 3; i++ {
+			allowed, _, err := l.Allow(ctx, "key")
+			assert.NoError(t, err)
+			assert.True(t, allowed, "expected request %d of burst to be allowed", i+1)
+		}
+		allowed, retryAfter, err := l.Allow(ctx, "key")
+		assert.NoError(t, err)
+		assert.False(t, allowed, "expected request over burst to be limited")
+		assert.Equal(t, time.Second, retryAfter)
+	})
+
+	t.Run("should restore tokens over time", func(t *testing.T) {
+		l := newLimiter()
+		for i := 0; i < 3; i++ {
+			l.Allow(ctx, "key")
+		}
+		now = now.Add(1500 * time.Millisecond)
+		allowed, _, _ := l.Allow(ctx, "key")
+		assert.True(t, allowed, "expected restored token to be taken")
+		allowed, retryAfter, _ := l.Allow(ctx, "key")
+		assert.False(t, allowed)
+		assert.Equal(t, 500*time.Millisecond, retryAfter)
+	})
+
+	t.Run("should limit keys independently", func(t *testing.T) {
+		l := newLimiter()
+		for i := 0; i < 3; i++ {
+			l.Allow(ctx, "key")
+		}
+		allowed, _, _ := l.Allow(ctx, "other key")
+		assert.True(t, allowed)
+	})
+
+	t.Run("should take tokens of all keys only if every key is allowed", func(t *testing.T) {
+		l := newLimiter()
+		for i := 0; i < 3; i++ {
+			l.Allow(ctx, "limited")
+		}
+		for i := 0; i < 3; i++ {
+			allowed, retryAfter, _ := l.Allow(ctx, "key", "limited")
+			assert.False(t, allowed, "expected request with limited key to be limited")
+			assert.Equal(t, time.Second, retryAfter)
+		}
+		for i := 0; i < 3; i++ {
+			allowed, _, _ := l.Allow(ctx, "key", "other key")
+			assert.True(t, allowed, "expected limited requests not to take tokens of other keys")
+		}
+		allowed, _, _ := l.Allow(ctx, "key", "other key")
+		assert.False(t, allowed)
+	})
+
+	t.Run("should remove full buckets", func(t *testing.T) {
+		l := newLimiter()
+		l.Allow(ctx, "key")
+		now = now.Add(tokenBucketSweepInterval)
+		l.Allow(ctx, "other key")
+		assert.Len(t, l.buckets, 1, "expected only bucket of the last key to be kept")
+	})
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	user := RequestUserData{CommonUserData: CommonUserData{UserName: "user1", Email: "e"}, Password: "123"}
+	newServer := func() *contractServer {
+		return newContractServer(t, &StubBlogStore{users: []RequestUserData{user}}, WithRateLimits(RateLimits{Auth: NewTokenBucketLimiter(2, time.Minute)}))
+	}
+
+	t.Run("should limit login attempts per username", func(t *testing.T) {
+		server := newServer()
+		for i, code := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+			wrongPassword := user
+			wrongPassword.Password = "wrong"
+			req, resp := makeAuthenticationRequestSuite(wrongPassword)
+			req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+			server.ServeHTTP(resp, req)
+			assertStatus(t, code, resp.Code, fmt.Sprintf("on login attempt %d", i+1))
+			if code == http.StatusTooManyRequests {
+				assert.Equal(t, "30", resp.Header().Get(HeaderKeyRetryAfter))
+			}
+		}
+	})
+
+	t.Run("should limit login attempts per client ip", func(t *testing.T) {
+		server := newServer()
+		for i, code := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+			other := user
+			other.UserName = fmt.Sprintf("user%d", i+10)
+			req, resp := makeAuthenticationRequestSuite(other)
+			req.RemoteAddr = "10.0.0.1:1234"
+			server.ServeHTTP(resp, req)
+			assertStatus(t, code, resp.Code, fmt.Sprintf("on login attempt %d", i+1))
+		}
+	})
+
+	t.Run("should not use up client ip limit by attempts of limited username", func(t *testing.T) {
+		server := newServer()
+		login := func(username, ip string) int {
+			attempt := user
+			attempt.UserName, attempt.Password = username, "wrong"
+			req, resp := makeAuthenticationRequestSuite(attempt)
+			req.RemoteAddr = ip + ":1234"
+			server.ServeHTTP(resp, req)
+			return resp.Code
+		}
+		for i := 0; i < 2; i++ {
+			login(user.UserName, "10.0.0.9")
+		}
+		for i := 0; i < 2; i++ {
+			assertStatus(t, http.StatusTooManyRequests, login(user.UserName, "10.0.0.1"), "for limited username")
+		}
+		for i := 0; i < 2; i++ {
+			assertStatus(t, http.StatusNotFound, login("user10", "10.0.0.1"), fmt.Sprintf("on login attempt %d of other username from the same ip", i+1))
+		}
+	})
+
+	t.Run("should limit login attempts per forwarded client ip behind trusted proxy", func(t *testing.T) {
+		proxies, _ := ParseTrustedProxies([]string{"10.0.0.1"})
+		server := newContractServer(t, &StubBlogStore{users: []RequestUserData{user}}, WithRateLimits(RateLimits{Auth: NewTokenBucketLimiter(2, time.Minute), TrustedProxies: proxies}))
+		login := func(username, forwardedFor string) int {
+			attempt := user
+			attempt.UserName, attempt.Password = username, "wrong"
+			req, resp := makeAuthenticationRequestSuite(attempt)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set(HeaderKeyXForwardedFor, forwardedFor)
+			server.ServeHTTP(resp, req)
+			return resp.Code
+		}
+		for i := 0; i < 2; i++ {
+			login(fmt.Sprintf("user%d", i+10), "198.51.100.1")
+		}
+		assertStatus(t, http.StatusTooManyRequests, login("user20", "198.51.100.1"), "for limited client behind proxy")
+		assertStatus(t, http.StatusNotFound, login("user21", "198.51.100.2"), "for other client behind the same proxy")
+	})
+
+	t.Run("should limit registration attempts", func(t *testing.T) {
+		server := newServer()
+		for i, code := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			req, resp := makeRegistrationRequestSuite(user)
+			server.ServeHTTP(resp, req)
+			assertStatus(t, code, resp.Code, fmt.Sprintf("on registration attempt %d", i+1))
+		}
+	})
+
+	t.Run("should return store error if limiter fails", func(t *testing.T) {
+		server := newContractServer(t, &StubBlogStore{}, WithRateLimits(RateLimits{Auth: FailingRateLimiter{}}))
+		req, resp := makeAuthenticationRequestSuite(user)
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	failOnNotEqual(t, err, nil, fmt.Sprintf("could not parse trusted proxies. %q", err))
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		expected   string
+	}{
+		{"connection ip without headers", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"connection ip of untrusted peer", "203.0.113.5:1234", map[string][]string{HeaderKeyXForwardedFor: {"198.51.100.1"}, HeaderKeyXRealIP: {"198.51.100.2"}}, "203.0.113.5"},
+		{"forwarded ip from trusted proxy", "10.0.0.1:1234", map[string][]string{HeaderKeyXForwardedFor: {"198.51.100.1"}}, "198.51.100.1"},
+		{"rightmost untrusted forwarded ip", "10.0.0.1:1234", map[string][]string{HeaderKeyXForwardedFor: {"1.1.1.1, 198.51.100.1, 10.0.0.7"}}, "198.51.100.1"},
+		{"forwarded ip from repeated headers", "192.168.1.1:1234", map[string][]string{HeaderKeyXForwardedFor: {"1.1.1.1", "198.51.100.1,10.0.0.7"}}, "198.51.100.1"},
+		{"leftmost ip if all hops are trusted", "10.0.0.1:1234", map[string][]string{HeaderKeyXForwardedFor: {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"last valid hop before malformed one", "10.0.0.1:1234", map[string][]string{HeaderKeyXForwardedFor: {"junk, 10.0.0.2"}}, "10.0.0.2"},
+		{"real ip from trusted proxy", "[::1]:1234", map[string][]string{HeaderKeyXRealIP: {"198.51.100.2"}}, "198.51.100.2"},
+		{"connection ip for malformed real ip", "10.0.0.1:1234", map[string][]string{HeaderKeyXRealIP: {"junk"}}, "10.0.0.1"},
+	}
+	for _, tc := range testCases {
+		t.Run("should return "+tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/users/login", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, values := range tc.headers {
+				for _, v := range values {
+					req.Header.Add(k, v)
+				}
+			}
+			assert.Equal(t, tc.expected, clientIP(req, proxies))
+		})
+	}
+
+	t.Run("should reject invalid trusted proxies", func(t *testing.T) {
+		for _, p := range []string{"", "10.0.0", "10.0.0.0/33", "proxy.local"} {
+			_, err := ParseTrustedProxies([]string{p})
+			assert.Error(t, err, "for proxy %q", p)
+		}
+	})
+}
+
+func TestWriteRateLimit(t *testing.T) {
+	user := RequestUserData{CommonUserData: CommonUserData{ID: 5, UserName: "user1"}}
+	server := newContractServer(t, &StubBlogStore{users: []RequestUserData{user}}, WithRateLimits(RateLimits{Write: NewTokenBucketLimiter(1, time.Minute)}))
+
+	t.Run("should limit writes per user", func(t *testing.T) {
+		for i, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			req, resp := makeCreateArticleRequestSuite(Article{Title: fmt.Sprintf("article %d", i)})
+			setAuth(req, AuthData{user.UserName})
+			server.ServeHTTP(resp, req)
+			assertStatus(t, code, resp.Code, fmt.Sprintf("on write %d", i+1))
+		}
+
+		req, resp := makeCreateArticleRequestSuite(Article{Title: "other user article"})
+		setAuth(req, AuthData{"user2"})
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for write of other user")
+	})
+
+	t.Run("should not limit reads", func(t *testing.T) {
+		req, resp := makeGetCurrentUserRequestSuite(user.UserName)
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for read after exhausted write limit")
+	})
+
+	t.Run("should not limit requests without valid token", func(t *testing.T) {
+		req, resp := makeCreateArticleRequestSuite(Article{Title: "anonymous"})
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusUnauthorized, resp.Code, "for write without token")
+	})
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Search ranking weights of article fields used by stores without full-text search
+const (
+	searchTitleWeight       = 3
+	searchDescriptionWeight = 2
+	searchBodyWeight        = 1
+)
+
+// searchSnippetWords is number of words in snippet of search hit
+const searchSnippetWords = 35
+
+// searchSnippetLead is number of words kept in snippet before the first match
+const searchSnippetLead = 5
+
+// Highlighting of matched words in search snippets
+const (
+	searchMarkStart = "<mark>"
+	searchMarkStop  = "</mark>"
+)
+
+// searchHeadlineOptions configures Postgres ts_headline to produce snippets like the ones built in go
+var searchHeadlineOptions = "StartSel=" + searchMarkStart + ", StopSel=" + searchMarkStop +
+	", MaxWords=" + strconv.Itoa(searchSnippetWords) + ", MinWords=15"
+
+func (s *BlogServer) serveSearchArticles(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		write422Response(w, err)
+		return
+	}
+	result, err := s.Store.SearchArticles(r.Context(), q)
+	if err != nil {
+		writeStoreError(w, err)
+	} else {
+		writeJSONResponse(w, result)
+	}
+}
+
+// parseSearchQuery reads search text from q param and paging from limit and offset params
+func parseSearchQuery(params url.Values) (q ArticleSearchQuery, e error) {
+	errors := []string{}
+	q = ArticleSearchQuery{Text: strings.TrimSpace(params.Get("q"))}
+	if q.Text == "" {
+		errors = append(errors, MsgMissingSearchQuery)
+	}
+	var limitErr, offsetErr error
+	q.Limit, limitErr = parsePageLimit(params)
+	if v := params.Get("offset"); v != "" {
+		q.Offset, offsetErr = strconv.Atoi(v)
+	}
+	if limitErr != nil || offsetErr != nil || q.Offset < 0 {
+		errors = append(errors, MsgInvalidPaging)
+	}
+	if len(errors) > 0 {
+		e = newUnprocessableEntityResponse(errors...)
+	}
+	return q, e
+}
+
+// searchTerms splits text to unique lower case words
+func searchTerms(text string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, t := range strings.FieldsFunc(strings.ToLower(text), isNotWordRune) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// rankArticles is full-text search fallback for stores without one. Article matches if every term
+// is a prefix of some word in it. Rank is number of matched words weighted by field
+func rankArticles(articles []Article, q ArticleSearchQuery) ArticleSearchResult {
+	result := ArticleSearchResult{Articles: []ArticleSearchHit{}, Limit: q.Limit, Offset: q.Offset}
+	terms := searchTerms(q.Text)
+	if len(terms) == 0 {
+		return result
+	}
+	hits := []ArticleSearchHit{}
+	for _, a := range articles {
+		matched := map[string]bool{}
+		rank := searchTitleWeight*countMatches(a.Title, terms, matched) +
+			searchDescriptionWeight*countMatches(a.Description, terms, matched) +
+			searchBodyWeight*countMatches(a.Body, terms, matched)
+		if len(matched) == len(terms) {
+			hits = append(hits, ArticleSearchHit{Article: a, Rank: float64(rank)})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	result.Total = len(hits)
+	if q.Offset < len(hits) {
+		hits = hits[q.Offset:]
+		if q.Limit < len(hits) {
+			hits = hits[:q.Limit]
+		}
+		for i := range hits {
+			hits[i].Snippet = searchSnippet(hits[i].Article, terms)
+		}
+		result.Articles = hits
+	}
+	return result
+}
+
+// countMatches returns number of words in text which match any term. Matched terms are added to matched
+func countMatches(text string, terms []string, matched map[string]bool) int {
+	count := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isNotWordRune) {
+		if term, ok := matchTerm(word, terms); ok {
+			matched[term] = true
+			count++
+		}
+	}
+	return count
+}
+
+// matchTerm returns the first term which is prefix of lower case word
+func matchTerm(word string, terms []string) (string, bool) {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return term, true
+		}
+	}
+	return "", false
+}
+
+// searchSnippet returns html escaped fragment of article text around the first match with matched words highlighted
+func searchSnippet(a Article, terms []string) string {
+	words := strings.Fields(strings.Join([]string{a.Title, a.Description, a.Body}, " "))
+	marks := make([]bool, len(words))
+	first := -1
+	for i, w := range words {
+		for _, part := range strings.FieldsFunc(strings.ToLower(w), isNotWordRune) {
+			if _, ok := matchTerm(part, terms); ok {
+				marks[i] = true
+			}
+		}
+		if marks[i] && first < 0 {
+			first = i
+		}
+	}
+	start := first - searchSnippetLead
+	if start < 0 {
+		start = 0
+	}
+	end := start + searchSnippetWords
+	if end > len(words) {
+		end = len(words)
+	}
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		if i > start {
+			b.WriteByte(' ')
+		}
+		if marks[i] {
+			b.WriteString(searchMarkStart + html.EscapeString(words[i]) + searchMarkStop)
+		} else {
+			b.WriteString(html.EscapeString(words[i]))
+		}
+	}
+	return b.String()
+}
+
+// htmlEscapeSQL wraps sql text expression to escape html special characters like searchSnippet does
+func htmlEscapeSQL(expr string) string {
+	for _, r := range []struct{ from, to string }{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"}} {
+		expr = "replace(" + expr + ", '" + strings.ReplaceAll(r.from, "'", "''") + "', '" + r.to + "')"
+	}
+	return expr
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchArticles(t *testing.T) {
+	articles := []Article{
+		{ID: 1, Slug: "go-tips", Title: "Go tips", Body: "Use gofmt"},
+		{ID: 2, Slug: "gophers", Title: "Gophers", Description: "About go"},
+		{ID: 3, Slug: "rust", Title: "Rust", Body: "Not about it"},
+	}
+	server := newContractServer(t, &StubBlogStore{articles: articles})
+
+	t.Run("should return ranked page of matching articles", func(t *testing.T) {
+		req, resp := makeSearchArticlesRequestSuite(url.Values{"q": {"go"}, "limit": {"1"}})
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for search")
+		var result ArticleSearchResult
+		failOnNotEqual(t, json.NewDecoder(resp.Body).Decode(&result), nil, "could not decode search result")
+		assert.Equal(t, 2, result.Total)
+		assert.Equal(t, 1, result.Limit)
+		if assert.Len(t, result.Articles, 1) {
+			assert.Equal(t, "gophers", result.Articles[0].Slug)
+		}
+	})
+
+	t.Run("should use default limit", func(t *testing.T) {
+		req, resp := makeSearchArticlesRequestSuite(url.Values{"q": {"go"}})
+		server.ServeHTTP(resp, req)
+		var result ArticleSearchResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		assert.Equal(t, DefaultPageLimit, result.Limit)
+	})
+
+	t.Run("should return 422 for invalid params", func(t *testing.T) {
+		for _, params := range []url.Values{
+			{},
+			{"q": {"  "}},
+			{"q": {"go"}, "limit": {"0"}},
+			{"q": {"go"}, "limit": {"101"}},
+			{"q": {"go"}, "limit": {"ten"}},
+			{"q": {"go"}, "offset": {"-1"}},
+		} {
+			req, resp := makeSearchArticlesRequestSuite(params)
+			server.ServeHTTP(resp, req)
+			assertStatus(t, http.StatusUnprocessableEntity, resp.Code, "for params "+params.Encode())
+		}
+	})
+}
+
+func TestRankArticles(t *testing.T) {
+	t.Run("should match word prefixes case insensitively", func(t *testing.T) {
+		result := rankArticles([]Article{{ID: 1, Title: "Running GOPHERS"}}, ArticleSearchQuery{Text: "run gopher", Limit: 10})
+		assert.Equal(t, 1, result.Total)
+	})
+
+	t.Run("should escape snippet and highlight matched words", func(t *testing.T) {
+		result := rankArticles([]Article{{ID: 1, Title: "<b>Go</b> & gophers"}}, ArticleSearchQuery{Text: "gophers", Limit: 10})
+		if assert.Len(t, result.Articles, 1) {
+			assert.Equal(t, "&lt;b&gt;Go&lt;/b&gt; &amp; <mark>gophers</mark>", result.Articles[0].Snippet)
+		}
+	})
+
+	t.Run("should cut snippet around the first match", func(t *testing.T) {
+		body := ""
+		for i := 0; i < 100; i++ {
+			body += "word "
+		}
+		result := rankArticles([]Article{{ID: 1, Title: "title", Body: body + "match " + body}}, ArticleSearchQuery{Text: "match", Limit: 10})
+		if assert.Len(t, result.Articles, 1) {
+			snippet := result.Articles[0].Snippet
+			assert.Contains(t, snippet, "<mark>match</mark>")
+			assert.NotContains(t, snippet, "title")
+		}
+	})
+}
+
+func makeSearchArticlesRequestSuite(params url.Values) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(http.MethodGet, ArticleSearchPath+"?"+params.Encode(), nil)
+	return req, httptest.NewRecorder()
+}
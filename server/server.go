@@ -2,37 +2,155 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 // BlogStore stores blog data
 type BlogStore interface {
-	GetArticle(search string) (Article, error)
-	CreateArticle(a SingleArticleHTTPWrap) (Article, error)
-	GetUser(username string) (RequestUserData, error)
-	UpdateUser(username string, data RequestUserData) (RequestUserData, error)
-	Registration(user RequestUserData) (RequestUserData, error)
+	GetArticle(ctx context.Context, search string) (Article, error)
+	CreateArticle(ctx context.Context, a SingleArticleHTTPWrap) (Article, error)
+	// UpdateArticle updates article found by id. Slug follows the title and previous slug still finds the article.
+	// Non-zero version of article must match the stored one, otherwise ErrVersionConflict is returned
+	UpdateArticle(ctx context.Context, a Article) (Article, error)
+	// ListArticles returns page of articles ordered from newest to oldest
+	ListArticles(ctx context.Context, q ArticleListQuery) ([]Article, error)
+	// SearchArticles returns page of articles matching query text ordered by relevance
+	SearchArticles(ctx context.Context, q ArticleSearchQuery) (ArticleSearchResult, error)
+	GetUser(ctx context.Context, username string) (RequestUserData, error)
+	// UpdateUser updates user found by username. Non-zero version of data must match the stored one, otherwise ErrVersionConflict is returned
+	UpdateUser(ctx context.Context, username string, data RequestUserData) (RequestUserData, error)
+	Registration(ctx context.Context, user RequestUserData) (RequestUserData, error)
+	// GetLoginAttempts returns failed login attempts of username. Username without failures has zero attempts
+	GetLoginAttempts(ctx context.Context, username string) (LoginAttempts, error)
+	SaveLoginAttempts(ctx context.Context, a LoginAttempts) error
+	// ResetLoginAttempts forgets failed login attempts and unlocks username
+	ResetLoginAttempts(ctx context.Context, username string) error
+	// InTx runs f with store which applies all operations atomically. Nothing is applied if f returns error
+	InTx(ctx context.Context, f func(tx BlogStore) error) error
 }
 
 // BlogServer handles bolg api requests
 type BlogServer struct {
 	Store BlogStore
 	http.Handler
+	draining   int32
+	rateLimits RateLimits
+	lockout    LockoutPolicy
+	metrics    map[string]func() interface{}
+	now        func() time.Time
 }
 
 func (s *BlogServer) serveGetArticle(w http.ResponseWriter, r *http.Request) {
-	slug := strings.TrimPrefix(r.URL.Path, "/api/articles/")
-	article, err := s.Store.GetArticle(slug)
-	if err != nil {
+	slug := strings.TrimPrefix(r.URL.Path, ArticlesPath)
+	article, err := s.Store.GetArticle(r.Context(), slug)
+	if errors.Is(err, ErrNotFound) {
 		w.WriteHeader(http.StatusNotFound)
+	} else if err != nil {
+		writeStoreError(w, err)
+	} else if article.Slug != slug {
+		http.Redirect(w, r, ArticlesPath+article.Slug, http.StatusMovedPermanently)
+	} else {
+		writeCacheableJSONResponse(w, r, SingleArticleHTTPWrap{article}, cacheControlPublic)
+	}
+}
+
+func (s *BlogServer) serveUpdateArticle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if reqData, err := parseCreateArticleBody(body); err != nil {
+		write422Response(w, err)
+	} else if version := articleVersion(reqData.Article); requireVersion(r, version) != nil {
+		writePreconditionResponse(w, errPreconditionRequired)
+	} else {
+		t, _ := TokenFromAuthHeader(r)
+		authData, _ := ParseToken(t)
+		var updatedArticle Article
+		e := s.Store.InTx(r.Context(), func(tx BlogStore) error {
+			a, e := tx.GetArticle(r.Context(), strings.TrimPrefix(r.URL.Path, ArticlesPath))
+			if e != nil {
+				return e
+			}
+			// articles without author can't be edited by anyone
+			if !a.AuthorID.Valid {
+				return errNotArticleAuthor
+			}
+			if u, e := tx.GetUser(r.Context(), authData.Login); errors.Is(e, ErrNotFound) || (e == nil && u.ID != int(a.AuthorID.Int32)) {
+				return errNotArticleAuthor
+			} else if e != nil {
+				return e
+			}
+			if e := checkVersion(r, SingleArticleHTTPWrap{a}, a.Version, version); e != nil {
+				return e
+			}
+			a.Title = reqData.Title
+			a.Description = reqData.Description
+			a.Body = reqData.Body
+			updatedArticle, e = tx.UpdateArticle(r.Context(), a)
+			return e
+		})
+		if errors.Is(e, ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(e, errNotArticleAuthor) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if errors.Is(e, ErrVersionConflict) {
+			writePreconditionResponse(w, e)
+		} else if errors.Is(e, ErrAlreadyExists) {
+			write422Response(w, newUnprocessableEntityResponse(MsgArticleAlreadyExists))
+		} else if e != nil {
+			writeStoreError(w, e)
+		} else {
+			writeJSONResponseWithETag(w, SingleArticleHTTPWrap{updatedArticle})
+		}
+	}
+}
+
+func (s *BlogServer) serveListArticles(w http.ResponseWriter, r *http.Request) {
+	q, cursor, err := parseListArticlesQuery(r.URL.Query())
+	if err != nil {
+		write422Response(w, err)
+		return
+	}
+	limit := q.Limit
+	q.Limit++
+	articles, err := s.Store.ListArticles(r.Context(), q)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	resp := ArticleListResponse{Articles: articles}
+	hasMore := len(articles) > limit
+	if cursor != nil && cursor.before {
+		if hasMore {
+			resp.Articles = articles[len(articles)-limit:]
+		}
+		if n := len(resp.Articles); n > 0 {
+			resp.Next = cursorOf(resp.Articles[n-1], false)
+			if hasMore {
+				resp.Prev = cursorOf(resp.Articles[0], true)
+			}
+		}
 	} else {
-		writeJSONResponse(w, SingleArticleHTTPWrap{article})
+		if hasMore {
+			resp.Articles = articles[:limit]
+		}
+		if n := len(resp.Articles); n > 0 {
+			if hasMore {
+				resp.Next = cursorOf(resp.Articles[n-1], false)
+			}
+			if cursor != nil {
+				resp.Prev = cursorOf(resp.Articles[0], true)
+			}
+		}
 	}
+	writeJSONResponse(w, resp)
 }
 
 func (s *BlogServer) serveCreateArticle(w http.ResponseWriter, r *http.Request) {
@@ -42,12 +160,25 @@ func (s *BlogServer) serveCreateArticle(w http.ResponseWriter, r *http.Request)
 	} else {
 		t, _ := TokenFromAuthHeader(r)
 		authData, _ := ParseToken(t)
-		u, e := s.Store.GetUser(authData.Login)
-		if e == nil {
-			reqData.AuthorID = sql.NullInt32{Int32: int32(u.ID), Valid: true}
+		var createdArticle Article
+		// nothing read here is checked, slug is claimed by unique index of the store
+		e := s.Store.InTx(withReadCommittedTx(r.Context()), func(tx BlogStore) error {
+			u, e := tx.GetUser(r.Context(), authData.Login)
+			if e == nil {
+				reqData.AuthorID = sql.NullInt32{Int32: int32(u.ID), Valid: true}
+			} else if !errors.Is(e, ErrNotFound) {
+				return e
+			}
+			createdArticle, e = tx.CreateArticle(r.Context(), reqData)
+			return e
+		})
+		if errors.Is(e, ErrAlreadyExists) {
+			write422Response(w, newUnprocessableEntityResponse(MsgArticleAlreadyExists))
+		} else if e != nil {
+			writeStoreError(w, e)
+		} else {
+			writeJSONResponse(w, createdArticle)
 		}
-		createdArticle, _ := s.Store.CreateArticle(reqData)
-		writeJSONResponse(w, createdArticle)
 	}
 }
 
@@ -55,8 +186,15 @@ func (s *BlogServer) serveRegistration(w http.ResponseWriter, r *http.Request) {
 	body, _ := ioutil.ReadAll(r.Body)
 	if user, err := parseRegistrationBody(body); err != nil {
 		write422Response(w, err)
-	} else {
-		registeredUser, _ := s.Store.Registration(user.User)
+	} else if allowRequest(w, r, s.rateLimits.Auth, authRateKeys(r, s.rateLimits.TrustedProxies, user.User.UserName)...) {
+		registeredUser, e := s.Store.Registration(r.Context(), user.User)
+		if errors.Is(e, ErrAlreadyExists) {
+			write422Response(w, newUnprocessableEntityResponse(MsgUserAlreadyExists))
+			return
+		} else if e != nil {
+			writeStoreError(w, e)
+			return
+		}
 		commonUserData := registeredUser.ToCommonUserData()
 		responseUser := ResponseUser{
 			User: ResponseUserData{
@@ -68,30 +206,21 @@ func (s *BlogServer) serveRegistration(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *BlogServer) serveUser(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.serveGetCurrentUser(w, r)
-	case http.MethodPut:
-		s.serveUpdateUser(w, r)
-	default:
-		w.WriteHeader(http.StatusNotFound)
-	}
-}
-
 func (s *BlogServer) serveGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	t, _ := TokenFromAuthHeader(r)
 	authData, _ := ParseToken(t)
-	u, e := s.Store.GetUser(authData.Login)
-	if e != nil {
+	u, e := s.Store.GetUser(r.Context(), authData.Login)
+	if errors.Is(e, ErrNotFound) {
 		w.WriteHeader(http.StatusNotFound)
+	} else if e != nil {
+		writeStoreError(w, e)
 	} else {
-		writeJSONResponse(w, ResponseUser{
+		writeCacheableJSONResponse(w, r, ResponseUser{
 			User: ResponseUserData{
 				CommonUserData: u.ToCommonUserData(),
 				Token:          t,
 			},
-		})
+		}, cacheControlPrivate)
 	}
 }
 
@@ -101,11 +230,19 @@ func (s *BlogServer) serveUpdateUser(w http.ResponseWriter, r *http.Request) {
 	authData, _ := ParseToken(t)
 	if requestUser, err := parseUpdateUserBody(body); err != nil {
 		write422Response(w, err)
+	} else if err = requireVersion(r, requestUser.User.Version); err != nil {
+		writePreconditionResponse(w, err)
 	} else {
-		foundUser, e := s.Store.GetUser(authData.Login)
-		if e != nil {
-			w.WriteHeader(http.StatusNotFound)
-		} else {
+		var u RequestUserData
+		e := s.Store.InTx(r.Context(), func(tx BlogStore) error {
+			foundUser, e := tx.GetUser(r.Context(), authData.Login)
+			if e != nil {
+				return e
+			}
+			current := ResponseUser{User: ResponseUserData{CommonUserData: foundUser.ToCommonUserData(), Token: t}}
+			if e = checkVersion(r, current, foundUser.Version, requestUser.User.Version); e != nil {
+				return e
+			}
 			if requestUser.User.UserName != nil {
 				foundUser.UserName = *requestUser.User.UserName
 			}
@@ -121,17 +258,24 @@ func (s *BlogServer) serveUpdateUser(w http.ResponseWriter, r *http.Request) {
 			if requestUser.User.Image != nil {
 				foundUser.Image = *requestUser.User.Image
 			}
-			u, e := s.Store.UpdateUser(authData.Login, foundUser)
-			if e != nil {
-				write500Response(w, e)
-			} else {
-				writeJSONResponse(w, ResponseUser{
-					User: ResponseUserData{
-						CommonUserData: u.ToCommonUserData(),
-						Token:          CreateToken(AuthData{u.UserName}),
-					},
-				})
-			}
+			u, e = tx.UpdateUser(r.Context(), authData.Login, foundUser)
+			return e
+		})
+		if errors.Is(e, ErrAlreadyExists) {
+			write422Response(w, newUnprocessableEntityResponse(MsgUserAlreadyExists))
+		} else if errors.Is(e, ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(e, ErrVersionConflict) {
+			writePreconditionResponse(w, e)
+		} else if e != nil {
+			writeStoreError(w, e)
+		} else {
+			writeJSONResponseWithETag(w, ResponseUser{
+				User: ResponseUserData{
+					CommonUserData: u.ToCommonUserData(),
+					Token:          CreateToken(AuthData{u.UserName}),
+				},
+			})
 		}
 	}
 }
@@ -140,10 +284,14 @@ func (s *BlogServer) serveAuthentication(w http.ResponseWriter, r *http.Request)
 	body, _ := ioutil.ReadAll(r.Body)
 	if user, err := parseAuthenticationBody(body); err != nil {
 		write422Response(w, err)
-	} else {
-		authenticatedUser, err := s.Store.GetUser(user.User.UserName)
-		if err != nil || authenticatedUser.Password != user.User.Password {
+	} else if allowRequest(w, r, s.rateLimits.Auth, authRateKeys(r, s.rateLimits.TrustedProxies, user.User.UserName)...) {
+		authenticatedUser, lockedFor, err := s.authenticate(r.Context(), user.User)
+		if errors.Is(err, ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
+		} else if err != nil {
+			writeStoreError(w, err)
+		} else if lockedFor > 0 {
+			writeLockedResponse(w, lockedFor)
 		} else {
 			commonUserData := authenticatedUser.ToCommonUserData()
 			responseUser := ResponseUser{
@@ -157,33 +305,60 @@ func (s *BlogServer) serveAuthentication(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (s *BlogServer) getRoutes() map[string]func(http.ResponseWriter, *http.Request) {
-	return map[string]func(http.ResponseWriter, *http.Request){
-		"/api/articles/":   s.serveGetArticle,
-		"/api/articles":    s.serveCreateArticle,
-		"/api/user":        s.serveUser,
-		"/api/users/login": s.serveAuthentication,
-		"/api/users":       s.serveRegistration,
+// routeHandlers are handlers of a route by http method
+type routeHandlers map[string]http.HandlerFunc
+
+// ServeHTTP calls handler of request method. Requests of other methods get 404 like requests of missing routes
+func (h routeHandlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := h[r.Method]; ok {
+		handler(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *BlogServer) getRoutes() map[string]routeHandlers {
+	return map[string]routeHandlers{
+		ArticlesPath:       {http.MethodGet: s.serveGetArticle, http.MethodPut: ApplyAuth(http.HandlerFunc(s.serveUpdateArticle)).ServeHTTP},
+		ArticleSearchPath:  {http.MethodGet: s.serveSearchArticles},
+		"/api/articles":    {http.MethodGet: s.serveListArticles, http.MethodPost: ApplyAuth(http.HandlerFunc(s.serveCreateArticle)).ServeHTTP},
+		"/api/user":        {http.MethodGet: s.serveGetCurrentUser, http.MethodPut: s.serveUpdateUser},
+		"/api/users/login": {http.MethodPost: s.serveAuthentication},
+		"/api/users":       {http.MethodPost: s.serveRegistration},
+		"/healthz":         {http.MethodGet: s.serveLiveness},
+		"/readyz":          {http.MethodGet: s.serveReadiness},
+		"/metrics":         {http.MethodGet: s.serveMetrics},
+		OpenAPIPath:        {http.MethodGet: s.serveOpenAPI},
 	}
 }
 
 // NewBlogServer initializes new instance of the blog server
-func NewBlogServer(s BlogStore) *BlogServer {
-	server := BlogServer{Store: s}
+func NewBlogServer(s BlogStore, opts ...ServerOption) *BlogServer {
+	o := newServerOptions(opts)
+	server := BlogServer{Store: s, rateLimits: o.rateLimits, lockout: o.lockout, metrics: o.metrics, now: time.Now}
 	router := http.NewServeMux()
 	for r, h := range server.getRoutes() {
-		var handler http.Handler = http.HandlerFunc(h)
+		var handler http.Handler = h
+		if needAuth(r) || r == ArticlesPath || r == "/api/articles" {
+			handler = limitWrites(server.rateLimits.Write, handler)
+		}
 		if needAuth(r) {
 			handler = ApplyAuth(handler)
 		}
 		router.Handle(r, handler)
 	}
 	server.Handler = router
+	if o.compression != nil {
+		server.Handler = applyCompression(*o.compression, server.Handler)
+	}
+	if o.cors != nil {
+		server.Handler = applyCORS(*o.cors, server.Handler)
+	}
 	return &server
 }
 
 func needAuth(route string) bool {
-	return route == "/api/articles" || route == "/api/user"
+	return route == "/api/user"
 }
 
 func parseRegistrationBody(b []byte) (data RequestUser, e error) {
@@ -217,7 +392,7 @@ func parseRegistrationBody(b []byte) (data RequestUser, e error) {
 func parseUpdateUserBody(b []byte) (data UpdateUserRequest, e error) {
 	decodeError := json.NewDecoder(bytes.NewBuffer(b)).Decode(&data)
 	if decodeError != nil {
-		e = &UnprocessableEntityResponse{Errors: UnprocessableEntityError{Body: []string{MsgInvalidBody}}}
+		e = newUnprocessableEntityResponse(MsgInvalidBody)
 	}
 	return data, e
 }
@@ -247,6 +422,39 @@ func parseAuthenticationBody(b []byte) (data RequestUser, e error) {
 	return data, e
 }
 
+// parseListArticlesQuery reads page limit and cursor from limit and cursor params
+func parseListArticlesQuery(params url.Values) (q ArticleListQuery, cursor *pageCursor, e error) {
+	errors := []string{}
+	var err error
+	if q.Limit, err = parsePageLimit(params); err != nil {
+		errors = append(errors, MsgInvalidPaging)
+	}
+	if v := params.Get("cursor"); v != "" {
+		if c, err := decodeCursor(v); err != nil {
+			errors = append(errors, MsgInvalidCursor)
+		} else {
+			cursor = &c
+			if c.before {
+				q.Before = &c.ArticleCursor
+			} else {
+				q.After = &c.ArticleCursor
+			}
+		}
+	}
+	if len(errors) > 0 {
+		e = newUnprocessableEntityResponse(errors...)
+	}
+	return q, cursor, e
+}
+
+// articleVersion returns version of article from request body. Articles start with version 1, so zero version is missing
+func articleVersion(a Article) *int {
+	if a.Version == 0 {
+		return nil
+	}
+	return &a.Version
+}
+
 func parseCreateArticleBody(b []byte) (data SingleArticleHTTPWrap, e error) {
 	errors := []string{}
 	decodeError := json.NewDecoder(bytes.NewBuffer(b)).Decode(&data)
@@ -278,6 +486,18 @@ func write422Response(w http.ResponseWriter, e error) {
 	w.Write([]byte(e.Error()))
 }
 
+// writeStoreError writes response for unexpected store error. Timeouts are reported as temporary unavailability
+func writeStoreError(w http.ResponseWriter, e error) {
+	if errors.Is(e, ErrTimeout) {
+		writeJSONContentType(w)
+		w.Header().Set(HeaderKeyRetryAfter, "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(e.Error()))
+	} else {
+		write500Response(w, e)
+	}
+}
+
 func write500Response(w http.ResponseWriter, e error) {
 	writeJSONContentType(w)
 	w.WriteHeader(http.StatusInternalServerError)
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,17 +10,19 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 type StubBlogStore struct {
-	articles []Article
-	users    []RequestUserData
+	articles      []Article
+	users         []RequestUserData
+	loginAttempts map[string]LoginAttempts
 }
 
-func (s *StubBlogStore) GetArticle(slug string) (article Article, e error) {
-	e = fmt.Errorf("Article with slug %q was not found", slug)
+func (s *StubBlogStore) GetArticle(ctx context.Context, slug string) (article Article, e error) {
+	e = fmt.Errorf("Article with slug %q: %w", slug, ErrNotFound)
 	for _, a := range s.articles {
 		if a.Slug == slug {
 			article = a
@@ -34,7 +37,7 @@ func (s *StubBlogStore) GetArticle(slug string) (article Article, e error) {
 	return
 }
 
-func (s *StubBlogStore) CreateArticle(a SingleArticleHTTPWrap) (Article, error) {
+func (s *StubBlogStore) CreateArticle(ctx context.Context, a SingleArticleHTTPWrap) (Article, error) {
 	a.Article.Slug = CreateSlug(a.Title)
 	s.articles = append(s.articles, a.Article)
 	if a.AuthorID.Valid {
@@ -44,8 +47,31 @@ func (s *StubBlogStore) CreateArticle(a SingleArticleHTTPWrap) (Article, error)
 	return a.Article, nil
 }
 
-func (s *StubBlogStore) GetUser(username string) (user RequestUserData, e error) {
-	e = fmt.Errorf("User with username %q was not found", username)
+func (s *StubBlogStore) UpdateArticle(ctx context.Context, a Article) (Article, error) {
+	for i := range s.articles {
+		if s.articles[i].ID == a.ID {
+			s.articles[i].Title = a.Title
+			s.articles[i].Slug = CreateSlug(a.Title)
+			return s.articles[i], nil
+		}
+	}
+	return a, fmt.Errorf("Article with id %d: %w", a.ID, ErrNotFound)
+}
+
+func (s *StubBlogStore) ListArticles(ctx context.Context, q ArticleListQuery) ([]Article, error) {
+	store := NewInMemoryBlogStore()
+	for _, a := range s.articles {
+		store.state.articles[a.ID] = a
+	}
+	return store.ListArticles(ctx, q)
+}
+
+func (s *StubBlogStore) SearchArticles(ctx context.Context, q ArticleSearchQuery) (ArticleSearchResult, error) {
+	return rankArticles(s.articles, q), nil
+}
+
+func (s *StubBlogStore) GetUser(ctx context.Context, username string) (user RequestUserData, e error) {
+	e = fmt.Errorf("User with username %q: %w", username, ErrNotFound)
 	for _, u := range s.users {
 		if u.UserName == username {
 			user = u
@@ -57,7 +83,7 @@ func (s *StubBlogStore) GetUser(username string) (user RequestUserData, e error)
 }
 
 func (s *StubBlogStore) GetUserByID(id int) (user RequestUserData, e error) {
-	e = fmt.Errorf("User with id %q was not found", id)
+	e = fmt.Errorf("User with id %d: %w", id, ErrNotFound)
 	for _, u := range s.users {
 		if u.ID == id {
 			user = u
@@ -68,7 +94,7 @@ func (s *StubBlogStore) GetUserByID(id int) (user RequestUserData, e error) {
 	return
 }
 
-func (s *StubBlogStore) UpdateUser(username string, data RequestUserData) (u RequestUserData, e error) {
+func (s *StubBlogStore) UpdateUser(ctx context.Context, username string, data RequestUserData) (u RequestUserData, e error) {
 	for i := range s.users {
 		if s.users[i].UserName == username {
 			s.users[i].UserName = data.UserName
@@ -83,19 +109,55 @@ func (s *StubBlogStore) UpdateUser(username string, data RequestUserData) (u Req
 	return
 }
 
-func (s *StubBlogStore) Registration(user RequestUserData) (RequestUserData, error) {
+func (s *StubBlogStore) Registration(ctx context.Context, user RequestUserData) (RequestUserData, error) {
 	s.users = append(s.users, user)
 	return user, nil
 }
 
+func (s *StubBlogStore) GetLoginAttempts(ctx context.Context, username string) (LoginAttempts, error) {
+	if a, ok := s.loginAttempts[username]; ok {
+		return a, nil
+	}
+	return LoginAttempts{Login: username}, nil
+}
+
+func (s *StubBlogStore) SaveLoginAttempts(ctx context.Context, a LoginAttempts) error {
+	if s.loginAttempts == nil {
+		s.loginAttempts = map[string]LoginAttempts{}
+	}
+	s.loginAttempts[a.Login] = a
+	return nil
+}
+
+func (s *StubBlogStore) ResetLoginAttempts(ctx context.Context, username string) error {
+	delete(s.loginAttempts, username)
+	return nil
+}
+
+func (s *StubBlogStore) InTx(ctx context.Context, f func(tx BlogStore) error) error {
+	return f(s)
+}
+
+// ContextStubBlogStore fails article lookups with error of finished request context
+type ContextStubBlogStore struct {
+	StubBlogStore
+}
+
+func (s *ContextStubBlogStore) GetArticle(ctx context.Context, slug string) (Article, error) {
+	if e := contextError(ctx); e != nil {
+		return Article{}, e
+	}
+	return s.StubBlogStore.GetArticle(ctx, slug)
+}
+
 //region article
 
 func TestGetArticle(t *testing.T) {
 	testCases := []Article{
-		Article{0, "some-art", "some art", sql.NullInt32{}, Profile{}},
-		Article{1, "some-other-art", "some other art", sql.NullInt32{}, Profile{}},
+		Article{ID: 0, Slug: "some-art", Title: "some art"},
+		Article{ID: 1, Slug: "some-other-art", Title: "some other art"},
 	}
-	server := NewBlogServer(&StubBlogStore{testCases, nil})
+	server := newContractServer(t, &StubBlogStore{articles: testCases})
 
 	t.Run("should return correct article by search value", func(t *testing.T) {
 		for _, a := range testCases {
@@ -112,11 +174,111 @@ func TestGetArticle(t *testing.T) {
 	})
 }
 
+func TestUpdateArticle(t *testing.T) {
+	author := RequestUserData{CommonUserData: CommonUserData{UserName: "author"}}
+	other := RequestUserData{CommonUserData: CommonUserData{UserName: "other"}}
+	newServer := func(t *testing.T) (*contractServer, Article) {
+		store := NewInMemoryBlogStore()
+		u, _ := store.Registration(context.Background(), author)
+		store.Registration(context.Background(), other)
+		a, err := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "old title", AuthorID: sql.NullInt32{Int32: int32(u.ID), Valid: true}}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("could not create test article. %q", err))
+		return newContractServer(t, store), a
+	}
+
+	t.Run("should return article with new slug", func(t *testing.T) {
+		server, a := newServer(t)
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, Article{Title: "New title", Version: a.Version})
+		setAuth(req, AuthData{author.UserName})
+		server.ServeHTTP(resp, req)
+		var updated SingleArticleHTTPWrap
+		assertSussessJSONResponse(t, resp, &updated)
+		assert.Equal(t, "New title", updated.Title)
+		assert.Equal(t, "new-title", updated.Slug)
+		assert.Equal(t, a.ID, updated.ID)
+	})
+
+	t.Run("should update description and body", func(t *testing.T) {
+		server, a := newServer(t)
+		changed := Article{Title: a.Title, Description: "new description", Body: "new body", Version: a.Version}
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, changed)
+		setAuth(req, AuthData{author.UserName})
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for update of body")
+
+		req, resp = makeGetArticleRequestSuite(a.Slug)
+		server.ServeHTTP(resp, req)
+		var got SingleArticleHTTPWrap
+		assertSussessJSONResponse(t, resp, &got)
+		assert.Equal(t, "new description", got.Description)
+		assert.Equal(t, "new body", got.Body)
+	})
+
+	t.Run("should redirect permanently from retired slug", func(t *testing.T) {
+		server, a := newServer(t)
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, Article{Title: "New title", Version: a.Version})
+		setAuth(req, AuthData{author.UserName})
+		server.ServeHTTP(resp, req)
+
+		req, resp = makeGetArticleRequestSuite(a.Slug)
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusMovedPermanently, resp.Code)
+		assert.Equal(t, ArticlesPath+"new-title", resp.Header().Get("Location"))
+
+		req, resp = makeGetArticleRequestSuite("new-title")
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "for canonical slug")
+	})
+
+	t.Run("should return 403 for not an author", func(t *testing.T) {
+		server, a := newServer(t)
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, Article{Title: "New title", Version: a.Version})
+		setAuth(req, AuthData{other.UserName})
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	t.Run("should return 403 for article without author", func(t *testing.T) {
+		store := NewInMemoryBlogStore()
+		store.Registration(context.Background(), author)
+		a, err := store.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: "orphan"}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("could not create test article. %q", err))
+		server := newContractServer(t, store)
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, Article{Title: "New title", Version: a.Version})
+		setAuth(req, AuthData{author.UserName})
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	t.Run("should return 401 without auth", func(t *testing.T) {
+		server, a := newServer(t)
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, Article{Title: "New title", Version: a.Version})
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("should return 404 on missing article", func(t *testing.T) {
+		server, _ := newServer(t)
+		req, resp := makeUpdateArticleRequestSuite("not-existing-art", Article{Title: "New title", Version: 1})
+		setAuth(req, AuthData{author.UserName})
+		server.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("should return 422 for missing title", func(t *testing.T) {
+		server, a := newServer(t)
+		req, resp := makeUpdateArticleRequestSuite(a.Slug, Article{})
+		setAuth(req, AuthData{author.UserName})
+		server.ServeHTTP(resp, req)
+		assert422(t, resp)
+	})
+}
+
 func TestCreateArticle(t *testing.T) {
-	article := Article{0, "new-art", "new art", sql.NullInt32{}, Profile{}}
+	article := Article{Slug: "new-art", Title: "new art"}
 	user := RequestUserData{CommonUserData: CommonUserData{ID: 5, UserName: "denis"}}
 	store := &StubBlogStore{users: []RequestUserData{user}}
-	server := NewBlogServer(store)
+	server := newContractServer(t, store)
 
 	t.Run("should return created article", func(t *testing.T) {
 		req, resp := makeCreateArticleRequestSuite(article)
@@ -127,7 +289,7 @@ func TestCreateArticle(t *testing.T) {
 		failOnEqual(t, createdArticle.Slug, "", "expected created article to have a slug")
 		assert.Equal(t, article.Title, createdArticle.Title, "response article must have expected title")
 		assert.Equal(t, user.UserName, createdArticle.Author.UserName, "response article must have expected author")
-		_, err := store.GetArticle(createdArticle.Slug)
+		_, err := store.GetArticle(context.Background(), createdArticle.Slug)
 		failOnNotEqual(
 			t,
 			err,
@@ -161,7 +323,17 @@ func TestCreateArticle(t *testing.T) {
 		}
 	})
 
-	//TODO: create test to check response on store level creation error
+	t.Run("should create article with unique slug for already existing title", func(t *testing.T) {
+		server := newContractServer(t, NewInMemoryBlogStore())
+		for i, slug := range []string{"new-art", "new-art-2"} {
+			req, resp := makeCreateArticleRequestSuite(article)
+			setAuth(req, AuthData{user.UserName})
+			server.ServeHTTP(resp, req)
+			var created Article
+			assertSussessJSONResponse(t, resp, &created)
+			assert.Equal(t, slug, created.Slug, "unexpected slug on creation attempt %d", i+1)
+		}
+	})
 }
 
 //endregion
@@ -171,7 +343,7 @@ func TestCreateArticle(t *testing.T) {
 func TestRegistration(t *testing.T) {
 	user := RequestUserData{CommonUserData: CommonUserData{UserName: "denis", Email: "denis@gmail.com"}, Password: "123"}
 	store := &StubBlogStore{}
-	server := NewBlogServer(store)
+	server := newContractServer(t, store)
 
 	t.Run("should return registered user", func(t *testing.T) {
 		req, resp := makeRegistrationRequestSuite(user)
@@ -179,7 +351,7 @@ func TestRegistration(t *testing.T) {
 		var registeredUser ResponseUser
 		assertSussessJSONResponse(t, resp, &registeredUser)
 		failOnEqual(t, "", registeredUser.User.Token, "expected registered user to have an auth token")
-		storeUser, err := store.GetUser(user.UserName)
+		storeUser, err := store.GetUser(context.Background(), user.UserName)
 		failOnNotEqual(
 			t,
 			err,
@@ -219,15 +391,25 @@ func TestRegistration(t *testing.T) {
 		}
 	})
 
+	t.Run("should return 422 with error body for already registered username", func(t *testing.T) {
+		server := newContractServer(t, NewInMemoryBlogStore())
+		req, resp := makeRegistrationRequestSuite(user)
+		server.ServeHTTP(resp, req)
+		assertStatus(t, http.StatusOK, resp.Code, "on first registration")
+		req, resp = makeRegistrationRequestSuite(user)
+		server.ServeHTTP(resp, req)
+		body := assert422(t, resp)
+		assert.Equal(t, []string{MsgUserAlreadyExists}, body.Errors.Body)
+	})
+
 	//TODO: test invalid email
-	//TODO: create test to check response on store level creation error
 }
 
 func TestGetCurrentUser(t *testing.T) {
 	username := "user1"
-	user := RequestUserData{CommonUserData: CommonUserData{UserName: username}}
-	store := &StubBlogStore{nil, []RequestUserData{user}}
-	server := NewBlogServer(store)
+	user := RequestUserData{CommonUserData: CommonUserData{ID: 7, UserName: username}}
+	store := &StubBlogStore{users: []RequestUserData{user}}
+	server := newContractServer(t, store)
 
 	t.Run("should return current user by auth token", func(t *testing.T) {
 		req, resp := makeGetCurrentUserRequestSuite(username)
@@ -237,6 +419,16 @@ func TestGetCurrentUser(t *testing.T) {
 		assert.Equal(t, username, currentUser.User.UserName, "exepected current user to have expected username")
 	})
 
+	t.Run("should not expose internal user id", func(t *testing.T) {
+		req, resp := makeGetCurrentUserRequestSuite(username)
+		server.ServeHTTP(resp, req)
+		var body map[string]map[string]interface{}
+		assertSussessJSONResponse(t, resp, &body)
+		assert.NotContains(t, body["User"], "ID")
+		other := ResponseUser{User: ResponseUserData{CommonUserData: CommonUserData{ID: 8, UserName: username}}}
+		assert.Equal(t, other.etag(), resp.Header().Get(HeaderKeyETag), "expected etag not to depend on user id")
+	})
+
 	t.Run("should return 404 for not existing user", func(t *testing.T) {
 		req, resp := makeGetCurrentUserRequestSuite(username + "123")
 		server.ServeHTTP(resp, req)
@@ -248,8 +440,8 @@ func TestAuthentication(t *testing.T) {
 	username := "user1"
 	password := "123"
 	user := RequestUserData{CommonUserData: CommonUserData{UserName: username}, Password: password}
-	store := &StubBlogStore{nil, []RequestUserData{user}}
-	server := NewBlogServer(store)
+	store := &StubBlogStore{users: []RequestUserData{user}}
+	server := newContractServer(t, store)
 
 	t.Run("should authenticate user by auth body data", func(t *testing.T) {
 		req, resp := makeAuthenticationRequestSuite(user)
@@ -305,16 +497,16 @@ func TestPutUser(t *testing.T) {
 	t.Run("should return updated user", func(t *testing.T) {
 		authData := AuthData{"u"}
 		u := RequestUserData{CommonUserData: CommonUserData{UserName: "u1", Bio: "b", Image: "i", Email: "e"}, Password: "p"}
-		updateUser := UpdateUserData{UserName: &(u.UserName), Email: &(u.Email), Password: &(u.Password), Bio: &(u.Bio), Image: &(u.Image)}
-		store := &StubBlogStore{nil, []RequestUserData{RequestUserData{CommonUserData: CommonUserData{UserName: authData.Login}}}}
-		server := NewBlogServer(store)
+		updateUser := UpdateUserData{UserName: &(u.UserName), Email: &(u.Email), Password: &(u.Password), Bio: &(u.Bio), Image: &(u.Image), Version: &(u.Version)}
+		store := &StubBlogStore{users: []RequestUserData{RequestUserData{CommonUserData: CommonUserData{UserName: authData.Login}}}}
+		server := newContractServer(t, store)
 		req, resp := makeUpdateUserRequestSuite(updateUser)
 		setAuth(req, authData)
 		server.ServeHTTP(resp, req)
 
 		var updatedUser ResponseUser
 		assertSussessJSONResponse(t, resp, &updatedUser)
-		storeUser, err := store.GetUser(u.UserName)
+		storeUser, err := store.GetUser(context.Background(), u.UserName)
 		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find user with updated username %q in store. got error %v", u.UserName, err))
 		assert.Equal(t, u.Email, storeUser.Email, "user email was not update correctly")
 		assert.Equal(t, u.Bio, storeUser.Bio, "user bio was not update correctly")
@@ -327,15 +519,15 @@ func TestPutUser(t *testing.T) {
 	t.Run("should not clear user fields that are not in json", func(t *testing.T) {
 		authData := AuthData{"u"}
 		primaryStoreUser := RequestUserData{CommonUserData: CommonUserData{UserName: authData.Login, Bio: "b", Image: "i", Email: "e"}, Password: "p"}
-		store := &StubBlogStore{nil, []RequestUserData{primaryStoreUser}}
-		server := NewBlogServer(store)
-		req, resp := makeUpdateUserRequestSuite(UpdateUserData{})
+		store := &StubBlogStore{users: []RequestUserData{primaryStoreUser}}
+		server := newContractServer(t, store)
+		req, resp := makeUpdateUserRequestSuite(UpdateUserData{Version: new(int)})
 		setAuth(req, authData)
 		server.ServeHTTP(resp, req)
 
 		var updatedUser ResponseUser
 		assertSussessJSONResponse(t, resp, &updatedUser)
-		resultStoreUser, err := store.GetUser(authData.Login)
+		resultStoreUser, err := store.GetUser(context.Background(), authData.Login)
 		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find user with old username %q in store. got error %v", authData.Login, err))
 		assert.Equal(t, primaryStoreUser.Email, resultStoreUser.Email, "expected user email to be not changed")
 		assert.Equal(t, primaryStoreUser.Bio, resultStoreUser.Bio, "user bio to be not changed")
@@ -345,16 +537,16 @@ func TestPutUser(t *testing.T) {
 
 	t.Run("should return 404 for not existing user", func(t *testing.T) {
 		authData := AuthData{"u"}
-		store := &StubBlogStore{nil, []RequestUserData{}}
-		server := NewBlogServer(store)
-		req, resp := makeUpdateUserRequestSuite(UpdateUserData{})
+		store := &StubBlogStore{users: []RequestUserData{}}
+		server := newContractServer(t, store)
+		req, resp := makeUpdateUserRequestSuite(UpdateUserData{Version: new(int)})
 		setAuth(req, authData)
 		server.ServeHTTP(resp, req)
 		assert.Equal(t, http.StatusNotFound, resp.Code)
 	})
 
 	t.Run("should return 422 with error body for invalid json request", func(t *testing.T) {
-		server := NewBlogServer(&StubBlogStore{})
+		server := newContractServer(t, &StubBlogStore{})
 		invalidBodies := [...]string{"", "{"}
 		for _, b := range invalidBodies {
 			req, resp := makeUpdateUserRawRequestSuite(b)
@@ -367,6 +559,27 @@ func TestPutUser(t *testing.T) {
 
 //endregion
 
+func TestStoreTimeout(t *testing.T) {
+	server := newContractServer(t, &ContextStubBlogStore{})
+
+	t.Run("should pass request context to store and return 503 on exceeded deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		req, resp := makeGetArticleRequestSuite("some-art")
+		server.ServeHTTP(resp, req.WithContext(ctx))
+		assertStatus(t, http.StatusServiceUnavailable, resp.Code, "on store timeout")
+		assert.NotEmpty(t, resp.Header().Get(HeaderKeyRetryAfter), "expected Retry-After header on store timeout")
+	})
+
+	t.Run("should return 500 on other store errors", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, resp := makeGetArticleRequestSuite("some-art")
+		server.ServeHTTP(resp, req.WithContext(ctx))
+		assertStatus(t, http.StatusInternalServerError, resp.Code, "on canceled request")
+	})
+}
+
 //TODO: create test for unsupported routes, invalid route + method pairs
 
 //TODO: add auth test for routes with auth
@@ -388,6 +601,12 @@ func makeCreateArticleRequestSuite(a Article) (*http.Request, *httptest.Response
 	return req, httptest.NewRecorder()
 }
 
+func makeUpdateArticleRequestSuite(slug string, a Article) (*http.Request, *httptest.ResponseRecorder) {
+	serializedArticle, _ := json.Marshal(SingleArticleHTTPWrap{a})
+	req, _ := http.NewRequest(http.MethodPut, "/api/articles/"+slug, bytes.NewBuffer(serializedArticle))
+	return req, httptest.NewRecorder()
+}
+
 func makeCreateArticleRawRequestSuite(body string) (*http.Request, *httptest.ResponseRecorder) {
 	req, _ := http.NewRequest(http.MethodPost, "/api/articles", bytes.NewBuffer([]byte(body)))
 	setAuth(req, AuthData{"user1"})
@@ -0,0 +1,76 @@
+// Package sqlite is SQLite blog store for single-binary deployments. It uses go-sqlite3 driver which requires cgo,
+// so it is kept out of server package and only binaries which serve SQLite import it
+package sqlite
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/trapck/go-rest-api/server"
+)
+
+// defaultParams are go-sqlite3 connection params applied unless dsn overrides them
+var defaultParams = []struct{ key, value string }{
+	{"_foreign_keys", "on"},
+	{"_busy_timeout", "5000"},
+}
+
+func init() {
+	server.RegisterDriverErrors(driverErrors{})
+}
+
+// BlogStore is implementation of blog store via SQLite. It runs the same queries as server.DBBlogStore
+type BlogStore struct {
+	server.DBBlogStore
+}
+
+// Init opens db file. DSN is path to db file with optional "sqlite:" prefix and go-sqlite3 query params
+func (s *BlogStore) Init() error {
+	db, err := sqlx.Connect(server.DialectSQLite, driverDSN(s.DSN))
+	if err != nil {
+		return err
+	}
+	// sqlite has a single writer anyway and single connection keeps ":memory:" db alive and shared
+	db.SetMaxOpenConns(1)
+	s.UseDB(db)
+	return nil
+}
+
+func driverDSN(dsn string) string {
+	dsn = strings.TrimPrefix(strings.TrimPrefix(dsn, server.SQLiteDSNScheme), "//")
+	params := []string{}
+	for _, p := range defaultParams {
+		if !strings.Contains(dsn, p.key+"=") {
+			params = append(params, p.key+"="+p.value)
+		}
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + strings.Join(params, "&")
+}
+
+// driverErrors recognizes go-sqlite3 errors for server.DBBlogStore
+type driverErrors struct{}
+
+func (driverErrors) IsUniqueViolation(e error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(e, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (driverErrors) IsForeignKeyViolation(e error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(e, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+func (driverErrors) IsBusy(e error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(e, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
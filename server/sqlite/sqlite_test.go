@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriverDSN(t *testing.T) {
+	testCases := map[string]string{
+		"sqlite:blog.db":                   "blog.db?_foreign_keys=on&_busy_timeout=5000",
+		"sqlite:///var/lib/blog.db":        "/var/lib/blog.db?_foreign_keys=on&_busy_timeout=5000",
+		"sqlite::memory:":                  ":memory:?_foreign_keys=on&_busy_timeout=5000",
+		"sqlite:blog.db?_busy_timeout=100": "blog.db?_busy_timeout=100&_foreign_keys=on",
+		"sqlite:blog.db?_foreign_keys=off": "blog.db?_foreign_keys=off&_busy_timeout=5000",
+	}
+	for dsn, want := range testCases {
+		assert.Equal(t, want, driverDSN(dsn), "unexpected driver dsn for %q", dsn)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLiteDSNScheme is prefix of dsn which selects SQLite store, e.g. sqlite:/var/lib/blog.db.
+// SQLite driver requires cgo, so the store is in server/sqlite package and DBBlogStore only runs its dialect
+const SQLiteDSNScheme = "sqlite:"
+
+// sqliteTimestampFormat is format of timestamp column defaults in SQLite migrations
+const sqliteTimestampFormat = "2006-01-02 15:04:05.000"
+
+// IsSQLiteDSN reports if dsn selects SQLite store of server/sqlite package
+func IsSQLiteDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, SQLiteDSNScheme)
+}
+
+// searchArticlesByLike selects articles which contain every search term and ranks them in go
+func (s *DBBlogStore) searchArticlesByLike(ctx context.Context, q ArticleSearchQuery) (ArticleSearchResult, error) {
+	terms := searchTerms(q.Text)
+	if len(terms) == 0 {
+		return rankArticles(nil, q), nil
+	}
+	conditions := make([]string, 0, len(terms))
+	args := make([]interface{}, 0, len(terms)*3)
+	for _, term := range terms {
+		conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR body LIKE ? ESCAPE '\')`)
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+	var articles []Article
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err := sqlx.SelectContext(qctx, s.conn(), &articles,
+		s.db.Rebind("SELECT "+articleColumns+" FROM article WHERE "+strings.Join(conditions, " AND ")), args...)
+	if err = wrapDBError(qctx, err, "search articles by %q", q.Text); err != nil {
+		return ArticleSearchResult{}, err
+	}
+	result := rankArticles(articles, q)
+	for i := range result.Articles {
+		if err = s.populateAuthor(ctx, &result.Articles[i].Article); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// likeEscaper escapes wildcards of LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -0,0 +1,13 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSQLiteDSN(t *testing.T) {
+	assert.True(t, IsSQLiteDSN("sqlite:blog.db"))
+	assert.False(t, IsSQLiteDSN("user=postgres dbname=postgres sslmode=disable"))
+	assert.False(t, IsSQLiteDSN("postgres://localhost/blog"))
+}
@@ -1,23 +1,80 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // db driver
+	"github.com/lib/pq"
 )
 
-// DBBlogStore is implementation of blog store via Postgres
+// Postgres error codes
+const (
+	pqUniqueViolation      = "23505"
+	pqForeignKeyViolation  = "23503"
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// DefaultMaxTxRetries is number of times transaction is retried after serialization failure when MaxTxRetries is not set
+const DefaultMaxTxRetries = 5
+
+// Delays before retries of transaction. Delay doubles with every next retry up to max and is randomized by half of it
+const (
+	txRetryBackoff    = 10 * time.Millisecond
+	txRetryMaxBackoff = time.Second
+)
+
+// txRetryRand randomizes retry delays, so transactions which conflicted don't retry at the same moment and conflict again
+var (
+	txRetryRandMu sync.Mutex
+	txRetryRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Supported sql dialects. Values are names of db drivers
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
+// Columns selected from db tables. They are listed explicitly to keep the order and ignore internal columns
+const (
+	articleColumns      = "id, slug, title, description, body, author_id, created_at, updated_at, version"
+	userColumns         = "id, login, password, email, bio, image, version"
+	loginAttemptColumns = "login, failures, locked_until"
+)
+
+// DefaultQueryTimeout is deadline of a single query used by DBBlogStore when QueryTimeout is not set
+const DefaultQueryTimeout = 5 * time.Second
+
+// DBBlogStore is implementation of blog store via Postgres. Queries are written in the way to be run by SQLite store as well.
+// Empty DSN connects with libpq defaults and PG* environment variables
 type DBBlogStore struct {
-	db *sqlx.DB
+	DSN          string
+	QueryTimeout time.Duration
+	MaxTxRetries int
+	db           *sqlx.DB
+	tx           *sqlx.Tx
+	// isolation is isolation level of transaction the store is bound to
+	isolation sql.IsolationLevel
 }
 
 // Init initializes connetion
 func (s *DBBlogStore) Init() (err error) {
-	s.db, err = sqlx.Connect("postgres", "user=postgres password=postgres dbname=postgres sslmode=disable")
+	s.db, err = sqlx.Connect(DialectPostgres, s.DSN)
 	return
 }
 
+// UseDB makes store run queries on db connected by other driver than lib/pq, e.g. by server/sqlite. It is used instead of Init
+func (s *DBBlogStore) UseDB(db *sqlx.DB) {
+	s.db = db
+}
+
 // Close closes connetion
 func (s *DBBlogStore) Close() (err error) {
 	var isConnected bool
@@ -27,62 +84,446 @@ func (s *DBBlogStore) Close() (err error) {
 	return
 }
 
-// GetArticle selects article from db by slug search value
-func (s *DBBlogStore) GetArticle(slug string) (Article, error) {
+// Ping checks that db is reachable
+func (s *DBBlogStore) Ping(ctx context.Context) error {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return e
+	}
+	return s.db.PingContext(ctx)
+}
+
+// GetArticle selects article from db by slug search value. Retired slugs are looked up in slug history,
+// so returned article may have different slug
+func (s *DBBlogStore) GetArticle(ctx context.Context, slug string) (Article, error) {
+	a, err := s.getArticleWhere(ctx, "slug=?", slug)
+	if errors.Is(err, ErrNotFound) {
+		a, err = s.getArticleWhere(ctx, "id=(SELECT article_id FROM article_slug_history WHERE slug=?)", slug)
+	}
+	if err != nil {
+		return a, fmt.Errorf("article with slug %q: %w", slug, err)
+	}
+	return a, nil
+}
+
+func (s *DBBlogStore) getArticleWhere(ctx context.Context, condition string, args ...interface{}) (Article, error) {
 	var a Article
-	err := s.db.Get(&a, "SELECT * FROM article WHERE slug=$1", slug)
-	if a.AuthorID.Valid && err == nil {
-		var u RequestUserData
-		if u, err = s.getUserByID(int(a.AuthorID.Int32)); err == nil {
-			a.Author = u.ToProfile()
-		}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err := sqlx.GetContext(qctx, s.conn(), &a, s.db.Rebind("SELECT "+articleColumns+" FROM article WHERE "+condition), args...)
+	if err = wrapDBError(qctx, err, "select article"); err == nil {
+		err = s.populateAuthor(ctx, &a)
 	}
 	return a, err
 }
 
+// populateAuthor sets author profile of article
+func (s *DBBlogStore) populateAuthor(ctx context.Context, a *Article) error {
+	if !a.AuthorID.Valid {
+		return nil
+	}
+	u, err := s.getUserByID(ctx, int(a.AuthorID.Int32))
+	if err == nil {
+		a.Author = u.ToProfile()
+	}
+	return err
+}
+
 // CreateArticle creates article in db
-func (s *DBBlogStore) CreateArticle(a SingleArticleHTTPWrap) (article Article, e error) {
+func (s *DBBlogStore) CreateArticle(ctx context.Context, a SingleArticleHTTPWrap) (article Article, e error) {
 	if isConnected, e := s.ensureConnection(); !isConnected {
 		return article, e
 	}
-	a.Slug = CreateSlug(a.Title)
-	_, err := s.db.Exec("INSERT INTO article (slug, title, author_id) VALUES ($1, $2, $3)", a.Slug, a.Title, a.AuthorID)
-	if a.AuthorID.Valid && err == nil {
-		if u, e := s.getUserByID(int(a.AuthorID.Int32)); e == nil {
-			a.Author = u.ToProfile()
+	// slug candidates are claimed by unique index rather than by checks, so read committed isolation is enough
+	e = s.inTx(ctx, sql.LevelReadCommitted, func(tx *DBBlogStore) (err error) {
+		article, err = tx.createArticle(ctx, a)
+		return
+	})
+	return
+}
+
+func (s *DBBlogStore) createArticle(ctx context.Context, a SingleArticleHTTPWrap) (Article, error) {
+	created, err := s.insertArticleWithUniqueSlug(ctx, a.Article, CreateSlug(a.Title))
+	if err == nil {
+		err = s.populateAuthor(ctx, &created)
+	}
+	return created, err
+}
+
+// insertArticleWithUniqueSlug inserts article trying slug candidates until one is free.
+// Taken slugs are skipped by unique index, so concurrent creates can't get the same slug. Retired slugs of other articles are skipped too
+func (s *DBBlogStore) insertArticleWithUniqueSlug(ctx context.Context, a Article, slug string) (Article, error) {
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		a.Slug = slugCandidate(slug, attempt)
+		created, inserted, err := s.insertArticleIfSlugFree(ctx, a)
+		if err != nil || inserted {
+			return created, err
+		}
+	}
+	return a, fmt.Errorf("article with slug %q: %w", slug, ErrAlreadyExists)
+}
+
+// insertArticleIfSlugFree inserts article unless its slug is taken. Insert runs in savepoint, because in serializable
+// transaction Postgres reports slug taken by concurrent transaction as serialization failure. The failure is rolled back
+// to the savepoint and the next candidate is tried instead of failing the whole transaction
+func (s *DBBlogStore) insertArticleIfSlugFree(ctx context.Context, a Article) (created Article, inserted bool, err error) {
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	if _, err = s.conn().ExecContext(qctx, "SAVEPOINT article_slug"); err != nil {
+		return a, false, wrapDBError(qctx, err, "article with slug %q", a.Slug)
+	}
+	err = sqlx.GetContext(qctx, s.conn(), &created,
+		s.db.Rebind("INSERT INTO article (slug, title, description, body, author_id) SELECT ?, ?, ?, ?, ? "+
+			"WHERE NOT EXISTS (SELECT 1 FROM article_slug_history WHERE slug=?) "+
+			"ON CONFLICT (slug) DO NOTHING RETURNING "+articleColumns),
+		a.Slug, a.Title, a.Description, a.Body, a.AuthorID, a.Slug)
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+		inserted = true
+	case qctx.Err() == nil && (errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pqErr) && pqErr.Code == pqSerializationFailure)):
+		created = a
+		_, err = s.conn().ExecContext(qctx, "ROLLBACK TO SAVEPOINT article_slug")
+	default:
+		return a, false, wrapDBError(qctx, err, "article with slug %q", a.Slug)
+	}
+	if err == nil {
+		_, err = s.conn().ExecContext(qctx, "RELEASE SAVEPOINT article_slug")
+	}
+	return created, inserted, wrapDBError(qctx, err, "article with slug %q", a.Slug)
+}
+
+// UpdateArticle updates article found by id. Slug follows the title and previous slug is kept in history
+func (s *DBBlogStore) UpdateArticle(ctx context.Context, a Article) (article Article, e error) {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return article, e
+	}
+	// article is read, checked and written back, so concurrent updates must be serialized
+	e = s.inTx(ctx, sql.LevelSerializable, func(tx *DBBlogStore) (err error) {
+		article, err = tx.updateArticle(ctx, a)
+		return
+	})
+	return
+}
+
+func (s *DBBlogStore) updateArticle(ctx context.Context, a Article) (Article, error) {
+	current, err := s.getArticleWhere(ctx, "id=?", a.ID)
+	if err != nil {
+		return a, fmt.Errorf("article with id %d: %w", a.ID, err)
+	}
+	if a.Version != 0 && a.Version != current.Version {
+		return a, fmt.Errorf("article with id %d of version %d: %w", a.ID, a.Version, ErrVersionConflict)
+	}
+	a.Slug = current.Slug
+	if CreateSlug(a.Title) != CreateSlug(current.Title) {
+		if a.Slug, err = s.availableSlug(ctx, a.ID, CreateSlug(a.Title)); err != nil {
+			return a, err
+		}
+	}
+	var updated Article
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err = sqlx.GetContext(qctx, s.conn(), &updated,
+		s.db.Rebind("UPDATE article SET slug=?, title=?, description=?, body=?, updated_at=?, version=version+1 "+
+			"WHERE id=? AND version=? RETURNING "+articleColumns),
+		a.Slug, a.Title, a.Description, a.Body, time.Now().UTC().Truncate(time.Microsecond), a.ID, current.Version)
+	if errors.Is(err, sql.ErrNoRows) && qctx.Err() == nil {
+		return a, fmt.Errorf("article with id %d of version %d: %w", a.ID, current.Version, ErrVersionConflict)
+	}
+	if err = wrapDBError(qctx, err, "article with slug %q", a.Slug); err != nil {
+		return a, err
+	}
+	if updated.Slug != current.Slug {
+		if err = s.retireSlug(qctx, current.Slug, updated.Slug, updated.ID); err != nil {
+			return a, err
+		}
+	}
+	return updated, s.populateAuthor(ctx, &updated)
+}
+
+// availableSlug returns first slug candidate which is not used by other articles now or in the past
+func (s *DBBlogStore) availableSlug(ctx context.Context, articleID int, slug string) (string, error) {
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		var taken int
+		candidate := slugCandidate(slug, attempt)
+		qctx, cancel := s.withQueryTimeout(ctx)
+		err := sqlx.GetContext(qctx, s.conn(), &taken,
+			s.db.Rebind("SELECT COUNT(*) FROM ("+
+				"SELECT id FROM article WHERE slug=? AND id<>? UNION ALL "+
+				"SELECT article_id FROM article_slug_history WHERE slug=? AND article_id<>?) taken"),
+			candidate, articleID, candidate, articleID)
+		err = wrapDBError(qctx, err, "article with slug %q", candidate)
+		cancel()
+		if err != nil || taken == 0 {
+			return candidate, err
+		}
+	}
+	return slug, fmt.Errorf("article with slug %q: %w", slug, ErrAlreadyExists)
+}
+
+// retireSlug moves previous slug of article to history. New slug is removed from history in case article gets it back
+func (s *DBBlogStore) retireSlug(ctx context.Context, previous, current string, articleID int) error {
+	_, err := s.conn().ExecContext(ctx, s.db.Rebind("DELETE FROM article_slug_history WHERE slug=?"), current)
+	if err == nil {
+		_, err = s.conn().ExecContext(ctx, s.db.Rebind("INSERT INTO article_slug_history (slug, article_id) VALUES (?, ?)"), previous, articleID)
+	}
+	return wrapDBError(ctx, err, "article slug history %q", previous)
+}
+
+// ListArticles selects page of articles by keyset on (created_at, id), so it is served by index and stable while articles are added.
+// created_at is the start time of the creating transaction rather than its commit time, so an article committed after
+// a page was read can sort behind cursors already handed out and be missed by them
+func (s *DBBlogStore) ListArticles(ctx context.Context, q ArticleListQuery) ([]Article, error) {
+	condition, order, args := "", "created_at DESC, id DESC", []interface{}{}
+	if q.After != nil {
+		condition = "WHERE (created_at, id) < (?, ?) "
+		args = append(args, s.timestampArg(q.After.CreatedAt), q.After.ID)
+	} else if q.Before != nil {
+		condition, order = "WHERE (created_at, id) > (?, ?) ", "created_at, id"
+		args = append(args, s.timestampArg(q.Before.CreatedAt), q.Before.ID)
+	}
+	articles := []Article{}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err := sqlx.SelectContext(qctx, s.conn(), &articles,
+		s.db.Rebind("SELECT "+articleColumns+" FROM article "+condition+"ORDER BY "+order+" LIMIT ?"), append(args, q.Limit)...)
+	if err = wrapDBError(qctx, err, "list articles"); err != nil {
+		return articles, err
+	}
+	if q.Before != nil {
+		reverseArticles(articles)
+	}
+	for i := range articles {
+		if err = s.populateAuthor(ctx, &articles[i]); err != nil {
+			return articles, err
+		}
+	}
+	return articles, nil
+}
+
+// timestampArg returns query arg to compare with timestamp column. SQLite keeps timestamps as text,
+// so time is formatted the same way as column default to compare correctly
+func (s *DBBlogStore) timestampArg(t time.Time) interface{} {
+	if s.db.DriverName() == DialectSQLite {
+		return t.UTC().Format(sqliteTimestampFormat)
+	}
+	return t
+}
+
+// SearchArticles finds articles matching query by title, description and body using Postgres full-text search.
+// SQLite db has no text search, so matches are prefiltered by LIKE and ranked like in memory store
+func (s *DBBlogStore) SearchArticles(ctx context.Context, q ArticleSearchQuery) (ArticleSearchResult, error) {
+	if s.db.DriverName() == DialectSQLite {
+		return s.searchArticlesByLike(ctx, q)
+	}
+	result := ArticleSearchResult{Articles: []ArticleSearchHit{}, Limit: q.Limit, Offset: q.Offset}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err := sqlx.GetContext(qctx, s.conn(), &result.Total,
+		s.db.Rebind("SELECT COUNT(*) FROM article WHERE search @@ websearch_to_tsquery('english', ?)"), q.Text)
+	if err == nil && result.Total > q.Offset {
+		err = sqlx.SelectContext(qctx, s.conn(), &result.Articles,
+			s.db.Rebind("SELECT "+articleColumns+", ts_rank(search, q) AS rank, "+
+				"ts_headline('english', "+htmlEscapeSQL("concat_ws(' ', title, description, body)")+", q, '"+searchHeadlineOptions+"') AS snippet "+
+				"FROM article, websearch_to_tsquery('english', ?) q WHERE search @@ q "+
+				"ORDER BY rank DESC, id DESC LIMIT ? OFFSET ?"),
+			q.Text, q.Limit, q.Offset)
+	}
+	if err = wrapDBError(qctx, err, "search articles by %q", q.Text); err != nil {
+		return result, err
+	}
+	for i := range result.Articles {
+		if err = s.populateAuthor(ctx, &result.Articles[i].Article); err != nil {
+			return result, err
 		}
 	}
-	return a.Article, err
+	return result, nil
 }
 
 // GetUser returns user from db
-func (s *DBBlogStore) GetUser(username string) (RequestUserData, error) {
+func (s *DBBlogStore) GetUser(ctx context.Context, username string) (RequestUserData, error) {
 	var u RequestUserData
-	e := s.db.Get(&u, "SELECT * FROM usr WHERE login=$1", username)
-	return u, e
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	e := sqlx.GetContext(qctx, s.conn(), &u, s.db.Rebind("SELECT "+userColumns+" FROM usr WHERE login=?"), username)
+	return u, wrapDBError(qctx, e, "user with username %q", username)
 }
 
-func (s *DBBlogStore) getUserByID(id int) (RequestUserData, error) {
+func (s *DBBlogStore) getUserByID(ctx context.Context, id int) (RequestUserData, error) {
 	var u RequestUserData
-	e := s.db.Get(&u, "SELECT * FROM usr WHERE id=$1", id)
-	return u, e
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	e := sqlx.GetContext(qctx, s.conn(), &u, s.db.Rebind("SELECT "+userColumns+" FROM usr WHERE id=?"), id)
+	return u, wrapDBError(qctx, e, "user with id %d", id)
 }
 
-// UpdateUser updates user in db
-func (s *DBBlogStore) UpdateUser(username string, data RequestUserData) (RequestUserData, error) {
-	_, err := s.db.Exec("UPDATE usr SET login=$1, password=$2, email=$3, bio=$4, image=$5 WHERE login=$6",
-		data.UserName, data.Password, data.Email, data.Bio, data.Image, username)
-	return data, err
+// UpdateUser updates user in db and returns stored data. Non-zero version of data must match the stored one
+func (s *DBBlogStore) UpdateUser(ctx context.Context, username string, data RequestUserData) (RequestUserData, error) {
+	var u RequestUserData
+	condition, args := "login=?", []interface{}{data.UserName, data.Password, data.Email, data.Bio, data.Image, username}
+	if data.Version != 0 {
+		condition, args = condition+" AND version=?", append(args, data.Version)
+	}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err := sqlx.GetContext(qctx, s.conn(), &u,
+		s.db.Rebind("UPDATE usr SET login=?, password=?, email=?, bio=?, image=?, version=version+1 WHERE "+condition+" RETURNING "+userColumns),
+		args...)
+	if errors.Is(err, sql.ErrNoRows) && qctx.Err() == nil && data.Version != 0 {
+		if _, e := s.GetUser(ctx, username); e == nil {
+			return u, fmt.Errorf("user with username %q of version %d: %w", username, data.Version, ErrVersionConflict)
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, wrapDBError(qctx, err, "user with username %q", username)
+	}
+	return u, wrapDBError(qctx, err, "user with username %q", data.UserName)
 }
 
-// Registration creates user in db
-func (s *DBBlogStore) Registration(user RequestUserData) (RequestUserData, error) {
+// Registration creates user in db and returns stored data
+func (s *DBBlogStore) Registration(ctx context.Context, user RequestUserData) (RequestUserData, error) {
 	if isConnected, e := s.ensureConnection(); !isConnected {
 		return RequestUserData{}, e
 	}
-	_, err := s.db.NamedExec(`INSERT INTO usr (login, password, email, image, bio)
-								VALUES (:login, :password, :email, :image, :bio)`, user)
-	return user, err
+	var u RequestUserData
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	err := sqlx.GetContext(qctx, s.conn(), &u,
+		s.db.Rebind("INSERT INTO usr (login, password, email, image, bio) VALUES (?, ?, ?, ?, ?) RETURNING "+userColumns),
+		user.UserName, user.Password, user.Email, user.Image, user.Bio)
+	return u, wrapDBError(qctx, err, "user with username %q", user.UserName)
+}
+
+// GetLoginAttempts returns failed login attempts of username from db. In read committed Postgres transaction
+// the username is locked until the transaction ends, so concurrent logins count failures one after another
+func (s *DBBlogStore) GetLoginAttempts(ctx context.Context, username string) (LoginAttempts, error) {
+	a := LoginAttempts{Login: username}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	if s.tx != nil && s.isolation == sql.LevelReadCommitted && s.db.DriverName() == DialectPostgres {
+		// advisory lock works for usernames without row as well
+		if _, e := s.tx.ExecContext(qctx, "SELECT pg_advisory_xact_lock(hashtext('login_attempt:' || $1))", username); e != nil {
+			return a, wrapDBError(qctx, e, "lock login attempts of %q", username)
+		}
+	}
+	e := sqlx.GetContext(qctx, s.conn(), &a, s.db.Rebind("SELECT "+loginAttemptColumns+" FROM login_attempt WHERE login=?"), username)
+	if errors.Is(e, sql.ErrNoRows) {
+		return a, nil
+	}
+	return a, wrapDBError(qctx, e, "login attempts of %q", username)
+}
+
+// SaveLoginAttempts inserts or replaces failed login attempts of username in db
+func (s *DBBlogStore) SaveLoginAttempts(ctx context.Context, a LoginAttempts) error {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return e
+	}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	_, e := s.conn().ExecContext(qctx,
+		s.db.Rebind("INSERT INTO login_attempt ("+loginAttemptColumns+") VALUES (?, ?, ?) "+
+			"ON CONFLICT (login) DO UPDATE SET failures=excluded.failures, locked_until=excluded.locked_until"),
+		a.Login, a.Failures, a.LockedUntil)
+	return wrapDBError(qctx, e, "login attempts of %q", a.Login)
+}
+
+// ResetLoginAttempts deletes failed login attempts of username from db
+func (s *DBBlogStore) ResetLoginAttempts(ctx context.Context, username string) error {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return e
+	}
+	qctx, cancel := s.withQueryTimeout(ctx)
+	defer cancel()
+	_, e := s.conn().ExecContext(qctx, s.db.Rebind("DELETE FROM login_attempt WHERE login=?"), username)
+	return wrapDBError(qctx, e, "login attempts of %q", username)
+}
+
+// InTx runs f in transaction with serializable isolation, or with read committed one if ctx is made by withReadCommittedTx.
+// Transaction is rolled back if f returns error and retried if it fails to serialize with concurrent transactions.
+// f must use only store it is given
+func (s *DBBlogStore) InTx(ctx context.Context, f func(tx BlogStore) error) error {
+	if isConnected, e := s.ensureConnection(); !isConnected {
+		return e
+	}
+	isolation := sql.LevelSerializable
+	if isReadCommittedTx(ctx) {
+		isolation = sql.LevelReadCommitted
+	}
+	return s.inTx(ctx, isolation, func(tx *DBBlogStore) error { return f(tx) })
+}
+
+// readCommittedTxKey is context key which makes DBBlogStore.InTx use read committed isolation
+type readCommittedTxKey struct{}
+
+// withReadCommittedTx makes transactions started with ctx run at read committed isolation instead of serializable.
+// It is for transactions which lock data they check, so they wait for concurrent ones instead of failing to serialize
+func withReadCommittedTx(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readCommittedTxKey{}, true)
+}
+
+func isReadCommittedTx(ctx context.Context) bool {
+	readCommitted, _ := ctx.Value(readCommittedTxKey{}).(bool)
+	return readCommitted
+}
+
+// inTx runs f in transaction with isolation. If store is already bound to transaction, f joins it
+func (s *DBBlogStore) inTx(ctx context.Context, isolation sql.IsolationLevel, f func(tx *DBBlogStore) error) (e error) {
+	if s.tx != nil {
+		return f(s)
+	}
+	maxRetries := s.MaxTxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxTxRetries
+	}
+	backoff := txRetryBackoff
+	for attempt := 0; ; attempt++ {
+		if e = s.runTx(ctx, isolation, f); !isSerializationFailure(e) || attempt >= maxRetries {
+			return
+		}
+		select {
+		case <-time.After(txRetryDelay(backoff)):
+			if backoff *= 2; backoff > txRetryMaxBackoff {
+				backoff = txRetryMaxBackoff
+			}
+		case <-ctx.Done():
+			return contextError(ctx)
+		}
+	}
+}
+
+// txRetryDelay returns random delay between half and one and a half of backoff
+func txRetryDelay(backoff time.Duration) time.Duration {
+	txRetryRandMu.Lock()
+	defer txRetryRandMu.Unlock()
+	return backoff/2 + time.Duration(txRetryRand.Int63n(int64(backoff)))
+}
+
+func (s *DBBlogStore) runTx(ctx context.Context, isolation sql.IsolationLevel, f func(tx *DBBlogStore) error) (e error) {
+	tx, e := s.db.BeginTxx(ctx, &sql.TxOptions{Isolation: isolation})
+	if e != nil {
+		return wrapDBError(ctx, e, "could not begin transaction")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		} else if e != nil {
+			tx.Rollback()
+		} else {
+			e = tx.Commit()
+		}
+	}()
+	txStore := *s
+	txStore.tx = tx
+	txStore.isolation = isolation
+	return f(&txStore)
+}
+
+// conn returns transaction if store is bound to it and db otherwise
+func (s *DBBlogStore) conn() sqlx.ExtContext {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
 }
 
 func (s *DBBlogStore) ensureConnection() (isConnected bool, e error) {
@@ -92,3 +533,72 @@ func (s *DBBlogStore) ensureConnection() (isConnected bool, e error) {
 	}
 	return
 }
+
+// withQueryTimeout limits ctx by deadline of a single query
+func (s *DBBlogStore) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := s.QueryTimeout
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// wrapDBError converts driver specific errors of a query run with ctx to blog store errors
+func wrapDBError(ctx context.Context, e error, format string, args ...interface{}) error {
+	var pqErr *pq.Error
+	switch {
+	case e == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf(format+": %w", append(args, contextError(ctx))...)
+	case errors.Is(e, sql.ErrNoRows):
+		return fmt.Errorf(format+": %w", append(args, ErrNotFound)...)
+	case errors.As(e, &pqErr) && pqErr.Code == pqUniqueViolation, isDriverError(e, DriverErrors.IsUniqueViolation):
+		return fmt.Errorf(format+": %w", append(args, ErrAlreadyExists)...)
+	case errors.As(e, &pqErr) && pqErr.Code == pqForeignKeyViolation, isDriverError(e, DriverErrors.IsForeignKeyViolation):
+		// referenced row is missing
+		return fmt.Errorf(format+": %w", append(args, ErrNotFound)...)
+	}
+	return e
+}
+
+// isSerializationFailure reports if transaction failed due to concurrent transactions and can be retried
+func isSerializationFailure(e error) bool {
+	var pqErr *pq.Error
+	if errors.As(e, &pqErr) {
+		return pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected
+	}
+	return isDriverError(e, DriverErrors.IsBusy)
+}
+
+// DriverErrors recognizes errors of sql driver other than lib/pq which DBBlogStore converts to blog store errors
+type DriverErrors interface {
+	IsUniqueViolation(e error) bool
+	IsForeignKeyViolation(e error) bool
+	// IsBusy reports if transaction failed due to concurrent transactions and can be retried
+	IsBusy(e error) bool
+}
+
+var (
+	driverErrorsMu sync.RWMutex
+	driverErrors   []DriverErrors
+)
+
+// RegisterDriverErrors makes DBBlogStore recognize errors of sql driver. It is called by packages of such drivers, e.g. server/sqlite
+func RegisterDriverErrors(d DriverErrors) {
+	driverErrorsMu.Lock()
+	defer driverErrorsMu.Unlock()
+	driverErrors = append(driverErrors, d)
+}
+
+// isDriverError reports if e is recognized by is of any registered driver
+func isDriverError(e error, is func(d DriverErrors, e error) bool) bool {
+	driverErrorsMu.RLock()
+	defer driverErrorsMu.RUnlock()
+	for _, d := range driverErrors {
+		if is(d, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,116 +1,377 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/trapck/go-rest-api/server/internal/testdb"
 )
 
 var testUser = RequestUserData{CommonUserData: CommonUserData{ID: 47, UserName: "unit_test"}}
 
 func TestInsertArticle(t *testing.T) {
-	db := initDB(t)
-	sessionID := createSessionID()
-	defer closeDB(t, db)
-	defer clearTestData(db, "article", fmt.Sprintf("title LIKE '%s'", "%"+sessionID+"%"))
-
-	inputArticle := SingleArticleHTTPWrap{Article{Title: fmt.Sprintf("test%s insert article", sessionID), AuthorID: sql.NullInt32{Int32: int32(testUser.ID), Valid: true}}}
-	outputArticle, err := db.CreateArticle(inputArticle)
-	failOnNotEqual(t, err, nil, fmt.Sprintf("article must be created without error, instead got : %s", err))
-	failOnEqual(t, "", outputArticle.Slug, "created article must have slug, but got empty string") //TODO: change slug to id
-	assert.Equal(t, testUser.UserName, outputArticle.Author.UserName, "created article must have expected author")
-	foundNewArticle, err := db.GetArticle(outputArticle.Slug)
-	failOnNotEqual(t, err, nil, fmt.Sprintf("expected to get just created article by slug value %q but got error. %q", outputArticle.Slug, err))
-	assert.Equal(t, inputArticle.Title, foundNewArticle.Title, "found in db new article should be found in db with the same title")
-	assert.Equal(t, testUser.UserName, foundNewArticle.Author.UserName, "found in db new article must have expected author")
-	// TODO: test duplicate rows
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		sessionID := createSessionID()
+		defer clearTestData(db, "article", fmt.Sprintf("title LIKE '%s'", "%"+sessionID+"%"))
+
+		inputArticle := SingleArticleHTTPWrap{Article{Title: fmt.Sprintf("test%s insert article", sessionID), AuthorID: sql.NullInt32{Int32: int32(testUser.ID), Valid: true}}}
+		outputArticle, err := db.CreateArticle(context.Background(), inputArticle)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("article must be created without error, instead got : %s", err))
+		failOnEqual(t, "", outputArticle.Slug, "created article must have slug, but got empty string") //TODO: change slug to id
+		assert.Equal(t, testUser.UserName, outputArticle.Author.UserName, "created article must have expected author")
+		assert.NotZero(t, outputArticle.ID, "created article must have id generated by db")
+		assert.False(t, outputArticle.CreatedAt.IsZero(), "created article must have creation time set by db")
+		assert.Equal(t, outputArticle.CreatedAt, outputArticle.UpdatedAt, "created article must have update time equal to creation time")
+		foundNewArticle, err := db.GetArticle(context.Background(), outputArticle.Slug)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to get just created article by slug value %q but got error. %q", outputArticle.Slug, err))
+		assert.Equal(t, inputArticle.Title, foundNewArticle.Title, "found in db new article should be found in db with the same title")
+		assert.Equal(t, outputArticle.ID, foundNewArticle.ID, "found in db new article must have the same id as returned on create")
+		assert.True(t, outputArticle.CreatedAt.Equal(foundNewArticle.CreatedAt), "found in db new article must have the same creation time as returned on create")
+		// TODO: test duplicate rows
+	})
 }
 
-func TestSelectArticle(t *testing.T) {
-	db := initDB(t)
-	defer closeDB(t, db)
+func TestInsertArticleSlugCollision(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		sessionID := createSessionID()
+		defer clearTestData(db, "article", fmt.Sprintf("title LIKE '%s'", "%"+sessionID+"%"))
+
+		title := fmt.Sprintf("Привет, мир! %s", sessionID)
+		const creates = 8
+		var wg sync.WaitGroup
+		results := make(chan Article, creates)
+		errs := make(chan error, creates)
+		for i := 0; i < creates; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var a Article
+				var err error
+				if i%2 == 0 {
+					a, err = db.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: title}})
+				} else {
+					// serializable transaction of the caller must not fail on slugs taken concurrently
+					err = db.InTx(context.Background(), func(tx BlogStore) (err error) {
+						a, err = tx.CreateArticle(context.Background(), SingleArticleHTTPWrap{Article{Title: title}})
+						return
+					})
+				}
+				results <- a
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(results)
+		close(errs)
+
+		for err := range errs {
+			failOnNotEqual(t, err, nil, fmt.Sprintf("expected all articles with the same title to be created but got %q", err))
+		}
+		slugs := map[string]bool{}
+		for a := range results {
+			assert.Regexp(t, "^privet-mir-"+sessionID, a.Slug)
+			slugs[a.Slug] = true
+		}
+		assert.Len(t, slugs, creates, "expected all articles to have unique slugs")
+	})
+}
+
+func TestUpdateArticleSlugHistory(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		sessionID := createSessionID()
+		defer clearTestData(db, "article", fmt.Sprintf("title LIKE '%s'", "%"+sessionID+"%"))
+		ctx := context.Background()
+
+		created, err := db.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: "first " + sessionID, AuthorID: sql.NullInt32{Int32: int32(testUser.ID), Valid: true}}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("could not create test article. %q", err))
+
+		renamed := created
+		renamed.Title = "second " + sessionID
+		updated, err := db.UpdateArticle(ctx, renamed)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article to be updated without error but got %q", err))
+		assert.Equal(t, created.ID, updated.ID)
+		assert.Equal(t, "second-"+sessionID, updated.Slug, "expected slug to follow the title")
+		assert.Equal(t, testUser.UserName, updated.Author.UserName, "expected updated article to have author")
+		assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt), "expected update time to move forward")
+
+		found, err := db.GetArticle(ctx, created.Slug)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find article by retired slug but got %q", err))
+		assert.Equal(t, updated.Slug, found.Slug, "expected article found by retired slug to have canonical slug")
+
+		other, err := db.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: "first " + sessionID}})
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article to be created without error but got %q", err))
+		assert.NotEqual(t, created.Slug, other.Slug, "expected retired slug not to be reused by other article")
+
+		renamed.Title = "First " + sessionID
+		renamed.Version = updated.Version
+		restored, err := db.UpdateArticle(ctx, renamed)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected article to get its retired slug back but got %q", err))
+		assert.Equal(t, created.Slug, restored.Slug)
+		found, err = db.GetArticle(ctx, updated.Slug)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to find article by retired slug but got %q", err))
+		assert.Equal(t, created.Slug, found.Slug)
+
+		renamed.ID = -1
+		_, err = db.UpdateArticle(ctx, renamed)
+		assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound for missing article but got %v", err)
+	})
+}
 
-	fakeSlug := "1 2 3 4 5"
-	a, err := db.GetArticle(fakeSlug)
-	failOnEqual(t, err, nil, fmt.Sprintf("expected to get an error for search by fake slug %q but found article %#v", fakeSlug, a))
-	// success test cases are covered in insert test
+func TestSelectArticle(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		fakeSlug := "1 2 3 4 5"
+		a, err := db.GetArticle(context.Background(), fakeSlug)
+		failOnEqual(t, err, nil, fmt.Sprintf("expected to get an error for search by fake slug %q but found article %#v", fakeSlug, a))
+		// success test cases are covered in insert test
+	})
 }
 
 func TestInsertUser(t *testing.T) {
-	db := initDB(t)
-	sessionID := createSessionID()
-	defer closeDB(t, db)
-	defer clearTestData(db, "usr", fmt.Sprintf("login LIKE '%s'", "%"+sessionID+"%"))
-
-	inputUser := RequestUserData{
-		CommonUserData: CommonUserData{
-			UserName: fmt.Sprintf("test%s registration", sessionID),
-			Email:    "registration@gmail.com",
-		},
-		Password: "123",
-	}
-	outputUser, err := db.Registration(inputUser)
-	failOnNotEqual(t, err, nil, fmt.Sprintf("user must be created without error, instead got : %s", err))
-	failOnNotEqual(
-		t,
-		inputUser.UserName,
-		outputUser.UserName,
-		fmt.Sprintf("created user must have username %q, but got %q", inputUser.UserName, outputUser.UserName),
-	) //TODO: change UserName to id
-	foundNewUser, err := db.GetUser(outputUser.UserName)
-	failOnNotEqual(t, err, nil, fmt.Sprintf("expected to get just created user by username value %q but got error. %q", outputUser.UserName, err))
-	assert.Equal(t, inputUser.Email, foundNewUser.Email, "new user should be found in db with the same email")
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		sessionID := createSessionID()
+		defer clearTestData(db, "usr", fmt.Sprintf("login LIKE '%s'", "%"+sessionID+"%"))
 
-	// TODO: test duplicate users
+		inputUser := RequestUserData{
+			CommonUserData: CommonUserData{
+				UserName: fmt.Sprintf("test%s registration", sessionID),
+				Email:    "registration@gmail.com",
+			},
+			Password: "123",
+		}
+		outputUser, err := db.Registration(context.Background(), inputUser)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("user must be created without error, instead got : %s", err))
+		failOnNotEqual(
+			t,
+			inputUser.UserName,
+			outputUser.UserName,
+			fmt.Sprintf("created user must have username %q, but got %q", inputUser.UserName, outputUser.UserName),
+		)
+		assert.NotZero(t, outputUser.ID, "created user must have id generated by db")
+		foundNewUser, err := db.GetUser(context.Background(), outputUser.UserName)
+		failOnNotEqual(t, err, nil, fmt.Sprintf("expected to get just created user by username value %q but got error. %q", outputUser.UserName, err))
+		assert.Equal(t, outputUser, foundNewUser, "new user should be found in db with the same data as returned on create")
+
+		// TODO: test duplicate users
+	})
 }
 
 func TestUpdateUser(t *testing.T) {
-	db := initDB(t)
-	sessionID := createSessionID()
-	currentUserName := "test_update_" + sessionID
-	defer closeDB(t, db)
-	defer clearTestData(db, "usr", fmt.Sprintf("login LIKE '%s'", "%"+sessionID+"%"))
-	_, e := db.db.Exec("INSERT INTO usr (login) VALUES ($1)", currentUserName)
-	failOnNotEqual(t, e, nil, fmt.Sprintf("could not insert test data into db. %q", e))
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		sessionID := createSessionID()
+		currentUserName := "test_update_" + sessionID
+		defer clearTestData(db, "usr", fmt.Sprintf("login LIKE '%s'", "%"+sessionID+"%"))
+		_, e := db.db.Exec(db.db.Rebind("INSERT INTO usr (login) VALUES (?)"), currentUserName)
+		failOnNotEqual(t, e, nil, fmt.Sprintf("could not insert test data into db. %q", e))
+
+		updateData := RequestUserData{CommonUserData: CommonUserData{UserName: currentUserName + "_updated", Email: "e", Bio: "b", Image: "i"}, Password: "p"}
+		updatedUser, e := db.UpdateUser(context.Background(), currentUserName, updateData)
 
-	updateData := RequestUserData{CommonUserData: CommonUserData{UserName: currentUserName + "_updated", Email: "e", Bio: "b", Image: "i"}, Password: "p"}
-	updatedUser, e := db.UpdateUser(currentUserName, updateData)
+		failOnNotEqual(t, e, nil, fmt.Sprintf("expected to update user without errors but got %q", e))
+		assert.NotZero(t, updatedUser.ID, "expected returned user to have id of stored row")
+		updateData.ID = updatedUser.ID
+		updateData.Version = 2
+		assert.Equal(t, updateData, updatedUser, "expected returned user to be equal to input data")
 
-	failOnNotEqual(t, e, nil, fmt.Sprintf("expected to update user without errors but got %q", e))
-	assert.Equal(t, updateData, updatedUser, "expected returned user to be equal to input data")
+		var storedUser RequestUserData
+		e = db.db.Get(&storedUser, db.db.Rebind("SELECT "+userColumns+" FROM usr WHERE login=?"), updateData.UserName)
+		failOnNotEqual(t, e, nil, fmt.Sprintf("expected to select updated user from db without errors but got %q", e))
+		assert.Equal(t, updateData, storedUser, "expected to find user with updated data in db")
 
-	e = db.db.Get(&updatedUser, "SELECT * FROM usr WHERE login=$1", updateData.UserName)
-	failOnNotEqual(t, e, nil, fmt.Sprintf("expected to select updated user from db without errors but got %q", e))
-	updateData.ID = updatedUser.ID
-	assert.Equal(t, updateData, updatedUser, "expected to find user with updated data in db")
+		_, e = db.UpdateUser(context.Background(), "missing "+sessionID, updateData)
+		assert.True(t, errors.Is(e, ErrNotFound), "expected ErrNotFound for missing user but got %v", e)
 
-	// TODO: test duplicate users
+		// TODO: test duplicate users
+	})
 }
 
 func TestSelectUser(t *testing.T) {
-	db := initDB(t)
-	defer closeDB(t, db)
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		fakeUserName := "user1 user2 user3 user4 user5"
+		a, err := db.GetUser(context.Background(), fakeUserName)
+		failOnEqual(t, err, nil, fmt.Sprintf("expected to get an error for search by fake username %q but found users %#v", fakeUserName, a))
+		// success test cases are covered in insert user test
+	})
+}
+
+// forEachDB runs test against every supported sql db
+func forEachDB(t *testing.T, test func(t *testing.T, db *DBBlogStore)) {
+	t.Run(DialectPostgres, func(t *testing.T) {
+		db := initDB(t)
+		defer closeDB(t, db)
+		test(t, db)
+	})
+	t.Run(DialectSQLite, func(t *testing.T) {
+		db := initSQLiteDB(t, true)
+		defer closeDB(t, db)
+		test(t, db)
+	})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		_, err := db.GetUser(ctx, testUser.UserName)
+		assert.True(t, errors.Is(err, ErrTimeout), "expected ErrTimeout for exceeded deadline but got %v", err)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = db.GetArticle(ctx, "some-art")
+		assert.True(t, errors.Is(err, context.Canceled), "expected context.Canceled for canceled context but got %v", err)
+		assert.False(t, errors.Is(err, ErrNotFound), "expected canceled lookup not to be reported as not found")
+	})
+}
+
+func TestInTx(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBBlogStore) {
+		sessionID := createSessionID()
+		defer clearTestData(db, "usr", fmt.Sprintf("login LIKE '%s'", "%"+sessionID+"%"))
+		ctx := context.Background()
 
-	fakeUserName := "user1 user2 user3 user4 user5"
-	a, err := db.GetUser(fakeUserName)
-	failOnEqual(t, err, nil, fmt.Sprintf("expected to get an error for search by fake username %q but found users %#v", fakeUserName, a))
-	// success test cases are covered in insert user test
+		t.Run("should commit all operations", func(t *testing.T) {
+			username := "test_tx_commit_" + sessionID
+			defer clearTestData(db, "article", fmt.Sprintf("title = '%s'", username))
+			err := db.InTx(ctx, func(tx BlogStore) error {
+				if _, err := tx.Registration(ctx, RequestUserData{CommonUserData: CommonUserData{UserName: username}}); err != nil {
+					return err
+				}
+				_, err := tx.CreateArticle(ctx, SingleArticleHTTPWrap{Article{Title: username}})
+				return err
+			})
+			failOnNotEqual(t, err, nil, fmt.Sprintf("expected transaction to be committed but got %q", err))
+			_, err = db.GetUser(ctx, username)
+			assert.NoError(t, err, "expected to find user created in transaction")
+		})
+
+		t.Run("should roll back all operations on error", func(t *testing.T) {
+			username := "test_tx_rollback_" + sessionID
+			err := db.InTx(ctx, func(tx BlogStore) error {
+				if _, err := tx.Registration(ctx, RequestUserData{CommonUserData: CommonUserData{UserName: username}}); err != nil {
+					return err
+				}
+				_, err := tx.Registration(ctx, RequestUserData{CommonUserData: CommonUserData{UserName: username}})
+				return err
+			})
+			assert.True(t, errors.Is(err, ErrAlreadyExists), "expected ErrAlreadyExists from transaction but got %v", err)
+			_, err = db.GetUser(ctx, username)
+			assert.True(t, errors.Is(err, ErrNotFound), "expected user created in failed transaction to be rolled back but got %v", err)
+		})
+
+		t.Run("should retry on serialization failure", func(t *testing.T) {
+			attempts := 0
+			err := db.InTx(ctx, func(tx BlogStore) error {
+				if attempts++; attempts < 3 {
+					return &pq.Error{Code: pqSerializationFailure}
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, attempts, "expected transaction to be retried until success")
+
+			attempts = 0
+			err = db.InTx(ctx, func(tx BlogStore) error {
+				attempts++
+				return &pq.Error{Code: pqSerializationFailure}
+			})
+			assert.Error(t, err)
+			assert.Equal(t, DefaultMaxTxRetries+1, attempts, "expected transaction retries to be limited")
+
+			limited := *db
+			limited.MaxTxRetries = 1
+			attempts = 0
+			err = limited.InTx(ctx, func(tx BlogStore) error {
+				attempts++
+				return &pq.Error{Code: pqSerializationFailure}
+			})
+			assert.Error(t, err)
+			assert.Equal(t, 2, attempts, "expected configured number of retries")
+		})
+
+		t.Run("should run read committed transaction for marked context", func(t *testing.T) {
+			isolations := []sql.IsolationLevel{}
+			for _, txCtx := range []context.Context{ctx, withReadCommittedTx(ctx)} {
+				err := db.InTx(txCtx, func(tx BlogStore) error {
+					isolations = append(isolations, tx.(*DBBlogStore).isolation)
+					_, err := tx.GetLoginAttempts(ctx, "locked_"+sessionID)
+					return err
+				})
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []sql.IsolationLevel{sql.LevelSerializable, sql.LevelReadCommitted}, isolations)
+		})
+	})
+}
+
+func TestTxRetryDelay(t *testing.T) {
+	delays := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		d := txRetryDelay(txRetryBackoff)
+		assert.True(t, d >= txRetryBackoff/2 && d < txRetryBackoff*3/2, "expected delay %s to be around backoff", d)
+		delays[d] = true
+	}
+	assert.Greater(t, len(delays), 1, "expected retry delays to be random")
 }
 
+// initDB opens postgres db from testdb.DSNEnv in a new schema. It is migrated and seeded with testUser
 func initDB(t *testing.T) *DBBlogStore {
 	t.Helper()
-	db := DBBlogStore{}
-	err := db.Init()
-	if err != nil {
+	db := DBBlogStore{DSN: testdb.Postgres(t)}
+	if err := db.Init(); err != nil {
 		assert.FailNow(t, "db connection was not established. ", err)
 	}
+	migrateTestDB(t, &db)
 	return &db
 }
 
+// openSQLiteTestDB opens sqlite db in a temp file. server/sqlite imports this package,
+// so the function is set by external tests with SetSQLiteTestDB
+var openSQLiteTestDB func(dsn string) (*DBBlogStore, error)
+
+// SetSQLiteTestDB sets function which opens sqlite db for tests of this package
+func SetSQLiteTestDB(open func(dsn string) (*DBBlogStore, error)) {
+	openSQLiteTestDB = open
+}
+
+// initSQLiteDB opens sqlite db in a temp file. Migrated db is seeded with testUser
+func initSQLiteDB(t *testing.T, migrate bool) *DBBlogStore {
+	t.Helper()
+	db, err := openSQLiteTestDB(SQLiteDSNScheme + filepath.Join(t.TempDir(), "blog.db"))
+	if err != nil {
+		assert.FailNow(t, "sqlite db was not opened. ", err)
+	}
+	if migrate {
+		migrateTestDB(t, db)
+	}
+	return db
+}
+
+// migrateTestDB applies migrations and seeds testUser
+func migrateTestDB(t *testing.T, db *DBBlogStore) {
+	t.Helper()
+	if _, err := db.MigrateUp(); err != nil {
+		assert.FailNow(t, "db was not migrated. ", err)
+	}
+	if _, err := db.db.Exec(db.db.Rebind("INSERT INTO usr (id, login) VALUES (?, ?)"), testUser.ID, testUser.UserName); err != nil {
+		assert.FailNow(t, "db was not seeded. ", err)
+	}
+	if db.db.DriverName() == DialectPostgres {
+		// explicit id does not move the sequence, so generated ids would collide with testUser later
+		if _, err := db.db.Exec("SELECT setval(pg_get_serial_sequence('usr', 'id'), (SELECT MAX(id) FROM usr))"); err != nil {
+			assert.FailNow(t, "db was not seeded. ", err)
+		}
+	}
+}
+
 func closeDB(t *testing.T, db *DBBlogStore) {
 	t.Helper()
 	err := db.Close()
@@ -0,0 +1,489 @@
+// Package storetest provides conformance tests for server.BlogStore implementations
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trapck/go-rest-api/server"
+)
+
+// Factory returns new empty store. It is called for every test group, so it should register cleanup via t.Cleanup
+type Factory func(t *testing.T) server.BlogStore
+
+// Run checks that store created by factory follows BlogStore semantics
+func Run(t *testing.T, factory Factory) {
+	t.Run("Registration", func(t *testing.T) { testRegistration(t, factory(t)) })
+	t.Run("GetUser", func(t *testing.T) { testGetUser(t, factory(t)) })
+	t.Run("UpdateUser", func(t *testing.T) { testUpdateUser(t, factory(t)) })
+	t.Run("CreateArticle", func(t *testing.T) { testCreateArticle(t, factory(t)) })
+	t.Run("GetArticle", func(t *testing.T) { testGetArticle(t, factory(t)) })
+	t.Run("UpdateArticle", func(t *testing.T) { testUpdateArticle(t, factory(t)) })
+	t.Run("ListArticles", func(t *testing.T) { testListArticles(t, factory(t)) })
+	t.Run("SearchArticles", func(t *testing.T) { testSearchArticles(t, factory(t)) })
+	t.Run("LoginAttempts", func(t *testing.T) { testLoginAttempts(t, factory(t)) })
+	t.Run("InTx", func(t *testing.T) { testInTx(t, factory(t)) })
+}
+
+func testRegistration(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	input := newUser("registered")
+	user, err := store.Registration(ctx, input)
+	require.NoError(t, err, "expected user to be registered")
+
+	t.Run("should return stored user with generated id and the first version", func(t *testing.T) {
+		assert.NotZero(t, user.ID)
+		input.ID = user.ID
+		input.Version = 1
+		assert.Equal(t, input, user)
+	})
+
+	t.Run("should assign unique ids", func(t *testing.T) {
+		other, err := store.Registration(ctx, newUser("other registered"))
+		require.NoError(t, err)
+		assert.NotEqual(t, user.ID, other.ID)
+	})
+
+	t.Run("should return ErrAlreadyExists for duplicate username", func(t *testing.T) {
+		_, err := store.Registration(ctx, newUser(user.UserName))
+		assertIs(t, err, server.ErrAlreadyExists)
+	})
+}
+
+func testGetUser(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	user := mustRegister(t, store, "found")
+
+	t.Run("should return user by username", func(t *testing.T) {
+		found, err := store.GetUser(ctx, user.UserName)
+		require.NoError(t, err)
+		assert.Equal(t, user, found)
+	})
+
+	t.Run("should return ErrNotFound for missing username", func(t *testing.T) {
+		_, err := store.GetUser(ctx, "missing")
+		assertIs(t, err, server.ErrNotFound)
+	})
+}
+
+func testUpdateUser(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	user := mustRegister(t, store, "updated")
+	other := mustRegister(t, store, "other updated")
+
+	t.Run("should return stored user and keep id", func(t *testing.T) {
+		data := user
+		data.ID = 0
+		data.UserName = "renamed"
+		data.Bio = "new bio"
+		updated, err := store.UpdateUser(ctx, user.UserName, data)
+		require.NoError(t, err)
+		data.ID = user.ID
+		data.Version = user.Version + 1
+		assert.Equal(t, data, updated)
+
+		found, err := store.GetUser(ctx, data.UserName)
+		require.NoError(t, err)
+		assert.Equal(t, updated, found)
+		_, err = store.GetUser(ctx, user.UserName)
+		assertIs(t, err, server.ErrNotFound)
+		user = updated
+	})
+
+	t.Run("should return ErrAlreadyExists for rename to taken username", func(t *testing.T) {
+		data := user
+		data.UserName = other.UserName
+		_, err := store.UpdateUser(ctx, user.UserName, data)
+		assertIs(t, err, server.ErrAlreadyExists)
+	})
+
+	t.Run("should return ErrVersionConflict for outdated version", func(t *testing.T) {
+		data := user
+		data.Version--
+		data.Bio = "lost update"
+		_, err := store.UpdateUser(ctx, user.UserName, data)
+		assertIs(t, err, server.ErrVersionConflict)
+		found, err := store.GetUser(ctx, user.UserName)
+		require.NoError(t, err)
+		assert.Equal(t, user, found)
+	})
+
+	t.Run("should return ErrNotFound for missing user", func(t *testing.T) {
+		_, err := store.UpdateUser(ctx, "missing", newUser("missing"))
+		assertIs(t, err, server.ErrNotFound)
+		missing := newUser("missing")
+		missing.Version = 1
+		_, err = store.UpdateUser(ctx, "missing", missing)
+		assertIs(t, err, server.ErrNotFound)
+	})
+}
+
+func testCreateArticle(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	author := mustRegister(t, store, "author")
+
+	t.Run("should return stored article with id, slug, timestamps and author", func(t *testing.T) {
+		a, err := store.CreateArticle(ctx, newArticle("Hello, World!", author))
+		require.NoError(t, err)
+		assert.NotZero(t, a.ID)
+		assert.Equal(t, "hello-world", a.Slug)
+		assert.Equal(t, "Hello, World!", a.Title)
+		assert.Equal(t, author.ToProfile(), a.Author)
+		assert.False(t, a.CreatedAt.IsZero(), "expected creation time to be set")
+		assert.True(t, a.CreatedAt.Equal(a.UpdatedAt), "expected update time of new article to be equal to creation time")
+	})
+
+	t.Run("should create article without author", func(t *testing.T) {
+		a, err := store.CreateArticle(ctx, server.SingleArticleHTTPWrap{Article: server.Article{Title: "anonymous"}})
+		require.NoError(t, err)
+		assert.False(t, a.AuthorID.Valid)
+		assert.Equal(t, server.Profile{}, a.Author)
+	})
+
+	t.Run("should add suffix to slug of duplicate title", func(t *testing.T) {
+		first, err := store.CreateArticle(ctx, newArticle("duplicate", author))
+		require.NoError(t, err)
+		second, err := store.CreateArticle(ctx, newArticle("Duplicate", author))
+		require.NoError(t, err)
+		assert.Equal(t, "duplicate", first.Slug)
+		assert.Equal(t, "duplicate-2", second.Slug)
+		assert.NotEqual(t, first.ID, second.ID)
+	})
+
+	t.Run("should return ErrNotFound for missing author", func(t *testing.T) {
+		_, err := store.CreateArticle(ctx, newArticle("orphan", server.RequestUserData{CommonUserData: server.CommonUserData{ID: 1 << 20}}))
+		assertIs(t, err, server.ErrNotFound)
+	})
+}
+
+func testGetArticle(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	author := mustRegister(t, store, "author")
+	created, err := store.CreateArticle(ctx, newArticle("found article", author))
+	require.NoError(t, err)
+
+	t.Run("should return article by slug with author", func(t *testing.T) {
+		found, err := store.GetArticle(ctx, created.Slug)
+		require.NoError(t, err)
+		assertSameArticle(t, created, found)
+	})
+
+	t.Run("should reflect author changes", func(t *testing.T) {
+		data := author
+		data.Bio = "changed bio"
+		_, err := store.UpdateUser(ctx, author.UserName, data)
+		require.NoError(t, err)
+		found, err := store.GetArticle(ctx, created.Slug)
+		require.NoError(t, err)
+		assert.Equal(t, "changed bio", found.Author.Bio)
+	})
+
+	t.Run("should return ErrNotFound for missing slug", func(t *testing.T) {
+		_, err := store.GetArticle(ctx, "missing")
+		assertIs(t, err, server.ErrNotFound)
+	})
+}
+
+func testUpdateArticle(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	author := mustRegister(t, store, "author")
+	created, err := store.CreateArticle(ctx, newArticle("first title", author))
+	require.NoError(t, err)
+	renamed := created
+	renamed.Title = "second title"
+
+	t.Run("should change slug with title and keep id and author", func(t *testing.T) {
+		updated, err := store.UpdateArticle(ctx, renamed)
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, updated.ID)
+		assert.Equal(t, "second-title", updated.Slug)
+		assert.Equal(t, "second title", updated.Title)
+		assert.Equal(t, author.ToProfile(), updated.Author)
+		assert.True(t, created.CreatedAt.Equal(updated.CreatedAt), "expected creation time to be kept")
+		assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt), "expected update time to move forward")
+		assert.Equal(t, created.Version+1, updated.Version)
+		renamed.Version = updated.Version
+	})
+
+	t.Run("should find article by retired slug", func(t *testing.T) {
+		found, err := store.GetArticle(ctx, created.Slug)
+		require.NoError(t, err)
+		assert.Equal(t, "second-title", found.Slug)
+	})
+
+	t.Run("should not give retired slug to other article", func(t *testing.T) {
+		other, err := store.CreateArticle(ctx, newArticle("first title", author))
+		require.NoError(t, err)
+		assert.NotEqual(t, created.Slug, other.Slug)
+	})
+
+	t.Run("should keep slug if title has the same slug", func(t *testing.T) {
+		renamed.Title = "Second   Title"
+		updated, err := store.UpdateArticle(ctx, renamed)
+		require.NoError(t, err)
+		assert.Equal(t, "second-title", updated.Slug)
+		assert.Equal(t, "Second   Title", updated.Title)
+		renamed.Version = updated.Version
+	})
+
+	t.Run("should return ErrVersionConflict for outdated version", func(t *testing.T) {
+		outdated := renamed
+		outdated.Version--
+		outdated.Title = "lost update"
+		_, err := store.UpdateArticle(ctx, outdated)
+		assertIs(t, err, server.ErrVersionConflict)
+		found, err := store.GetArticle(ctx, "second-title")
+		require.NoError(t, err)
+		assert.Equal(t, renamed.Version, found.Version)
+	})
+
+	t.Run("should return retired slug to its article", func(t *testing.T) {
+		renamed.Title = "first title"
+		updated, err := store.UpdateArticle(ctx, renamed)
+		require.NoError(t, err)
+		assert.Equal(t, created.Slug, updated.Slug)
+		renamed.Version = updated.Version
+		found, err := store.GetArticle(ctx, "second-title")
+		require.NoError(t, err)
+		assert.Equal(t, created.Slug, found.Slug)
+	})
+
+	t.Run("should return ErrNotFound for missing article", func(t *testing.T) {
+		missing := renamed
+		missing.ID = 1 << 20
+		_, err := store.UpdateArticle(ctx, missing)
+		assertIs(t, err, server.ErrNotFound)
+	})
+}
+
+func testListArticles(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	author := mustRegister(t, store, "author")
+	newest := make([]server.Article, 5)
+	for i := range newest {
+		a, err := store.CreateArticle(ctx, newArticle(fmt.Sprintf("article %d", i), author))
+		require.NoError(t, err)
+		newest[len(newest)-1-i] = a
+	}
+	cursorOf := func(a server.Article) *server.ArticleCursor {
+		return &server.ArticleCursor{CreatedAt: a.CreatedAt, ID: a.ID}
+	}
+	assertIDs := func(t *testing.T, want []server.Article, got []server.Article) {
+		t.Helper()
+		wantIDs, gotIDs := []int{}, []int{}
+		for _, a := range want {
+			wantIDs = append(wantIDs, a.ID)
+		}
+		for _, a := range got {
+			gotIDs = append(gotIDs, a.ID)
+		}
+		assert.Equal(t, wantIDs, gotIDs)
+	}
+
+	t.Run("should return newest articles with authors", func(t *testing.T) {
+		articles, err := store.ListArticles(ctx, server.ArticleListQuery{Limit: 2})
+		require.NoError(t, err)
+		assertIDs(t, newest[:2], articles)
+		if assert.NotEmpty(t, articles) {
+			assert.Equal(t, author.ToProfile(), articles[0].Author)
+		}
+	})
+
+	t.Run("should return older articles after cursor", func(t *testing.T) {
+		articles, err := store.ListArticles(ctx, server.ArticleListQuery{Limit: 2, After: cursorOf(newest[1])})
+		require.NoError(t, err)
+		assertIDs(t, newest[2:4], articles)
+	})
+
+	t.Run("should return closest newer articles before cursor from newest to oldest", func(t *testing.T) {
+		articles, err := store.ListArticles(ctx, server.ArticleListQuery{Limit: 2, Before: cursorOf(newest[4])})
+		require.NoError(t, err)
+		assertIDs(t, newest[2:4], articles)
+	})
+
+	t.Run("should not skip articles created after the first page", func(t *testing.T) {
+		_, err := store.CreateArticle(ctx, newArticle("latest", author))
+		require.NoError(t, err)
+		articles, err := store.ListArticles(ctx, server.ArticleListQuery{Limit: 10, After: cursorOf(newest[1])})
+		require.NoError(t, err)
+		assertIDs(t, newest[2:], articles)
+	})
+}
+
+func testSearchArticles(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+	author := mustRegister(t, store, "author")
+	create := func(title, description, body string) server.Article {
+		a := newArticle(title, author)
+		a.Description, a.Body = description, body
+		created, err := store.CreateArticle(ctx, a)
+		require.NoError(t, err, "could not create article %q", title)
+		return created
+	}
+	inBody := create("Weekly notes", "what happened", "Gophers met to talk about concurrency patterns")
+	inTitle := create("Gophers guide", "introduction to concurrency", "channels and goroutines")
+	create("Unrelated", "nothing here", "just text")
+
+	t.Run("should store description and body", func(t *testing.T) {
+		assert.Equal(t, "what happened", inBody.Description)
+		assert.Equal(t, "Gophers met to talk about concurrency patterns", inBody.Body)
+	})
+
+	t.Run("should rank title matches first", func(t *testing.T) {
+		result, err := store.SearchArticles(ctx, server.ArticleSearchQuery{Text: "gophers", Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Total)
+		require.Len(t, result.Articles, 2)
+		assert.Equal(t, inTitle.ID, result.Articles[0].ID)
+		assert.Equal(t, inBody.ID, result.Articles[1].ID)
+		assert.Greater(t, result.Articles[0].Rank, result.Articles[1].Rank)
+		assert.Equal(t, author.ToProfile(), result.Articles[0].Author)
+	})
+
+	t.Run("should highlight matches in snippet", func(t *testing.T) {
+		result, err := store.SearchArticles(ctx, server.ArticleSearchQuery{Text: "concurrency", Limit: 10})
+		require.NoError(t, err)
+		require.NotEmpty(t, result.Articles)
+		assert.Contains(t, result.Articles[0].Snippet, "<mark>concurrency</mark>")
+	})
+
+	t.Run("should match all terms", func(t *testing.T) {
+		result, err := store.SearchArticles(ctx, server.ArticleSearchQuery{Text: "gophers patterns", Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Total)
+		require.Len(t, result.Articles, 1)
+		assert.Equal(t, inBody.ID, result.Articles[0].ID)
+	})
+
+	t.Run("should return page of results with total", func(t *testing.T) {
+		result, err := store.SearchArticles(ctx, server.ArticleSearchQuery{Text: "gophers", Limit: 1, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Total)
+		assert.Equal(t, 1, result.Limit)
+		assert.Equal(t, 1, result.Offset)
+		require.Len(t, result.Articles, 1)
+		assert.Equal(t, inBody.ID, result.Articles[0].ID)
+	})
+
+	t.Run("should return empty result without matches", func(t *testing.T) {
+		result, err := store.SearchArticles(ctx, server.ArticleSearchQuery{Text: "missing", Limit: 10})
+		require.NoError(t, err)
+		assert.Zero(t, result.Total)
+		assert.Empty(t, result.Articles)
+	})
+}
+
+func testLoginAttempts(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+
+	t.Run("should return zero attempts for username without failures", func(t *testing.T) {
+		a, err := store.GetLoginAttempts(ctx, "clean")
+		require.NoError(t, err)
+		assert.Equal(t, server.LoginAttempts{Login: "clean"}, a)
+	})
+
+	t.Run("should save and replace attempts of any username", func(t *testing.T) {
+		lockedUntil := time.Now().UTC().Add(time.Minute).Truncate(time.Microsecond)
+		for _, a := range []server.LoginAttempts{
+			{Login: "guessed", Failures: 1},
+			{Login: "guessed", Failures: 2, LockedUntil: sql.NullTime{Time: lockedUntil, Valid: true}},
+		} {
+			require.NoError(t, store.SaveLoginAttempts(ctx, a))
+			found, err := store.GetLoginAttempts(ctx, a.Login)
+			require.NoError(t, err)
+			assert.Equal(t, a.Failures, found.Failures)
+			assert.Equal(t, a.LockedUntil.Valid, found.LockedUntil.Valid)
+			assert.True(t, a.LockedUntil.Time.Equal(found.LockedUntil.Time), "expected lock time %v but got %v", a.LockedUntil.Time, found.LockedUntil.Time)
+		}
+	})
+
+	t.Run("should reset attempts", func(t *testing.T) {
+		require.NoError(t, store.ResetLoginAttempts(ctx, "guessed"))
+		a, err := store.GetLoginAttempts(ctx, "guessed")
+		require.NoError(t, err)
+		assert.Zero(t, a.Failures)
+		assert.False(t, a.LockedUntil.Valid)
+		assert.NoError(t, store.ResetLoginAttempts(ctx, "never failed"), "expected reset of username without failures to succeed")
+	})
+}
+
+func testInTx(t *testing.T, store server.BlogStore) {
+	ctx := context.Background()
+
+	t.Run("should apply all operations on success", func(t *testing.T) {
+		err := store.InTx(ctx, func(tx server.BlogStore) error {
+			u, err := tx.Registration(ctx, newUser("committed"))
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateArticle(ctx, newArticle("committed", u))
+			return err
+		})
+		require.NoError(t, err)
+		a, err := store.GetArticle(ctx, "committed")
+		require.NoError(t, err)
+		assert.Equal(t, "committed", a.Author.UserName)
+	})
+
+	t.Run("should discard all operations on error", func(t *testing.T) {
+		failure := errors.New("failure")
+		err := store.InTx(ctx, func(tx server.BlogStore) error {
+			if _, err := tx.Registration(ctx, newUser("rolled back")); err != nil {
+				return err
+			}
+			return failure
+		})
+		assertIs(t, err, failure)
+		_, err = store.GetUser(ctx, "rolled back")
+		assertIs(t, err, server.ErrNotFound)
+	})
+
+	t.Run("should see own changes", func(t *testing.T) {
+		err := store.InTx(ctx, func(tx server.BlogStore) error {
+			if _, err := tx.Registration(ctx, newUser("visible")); err != nil {
+				return err
+			}
+			_, err := tx.GetUser(ctx, "visible")
+			return err
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func newUser(username string) server.RequestUserData {
+	return server.RequestUserData{
+		CommonUserData: server.CommonUserData{UserName: username, Email: username + "@example.com", Bio: "bio", Image: "image"},
+		Password:       "password",
+	}
+}
+
+func newArticle(title string, author server.RequestUserData) server.SingleArticleHTTPWrap {
+	return server.SingleArticleHTTPWrap{Article: server.Article{Title: title, AuthorID: sql.NullInt32{Int32: int32(author.ID), Valid: true}}}
+}
+
+func mustRegister(t *testing.T, store server.BlogStore, username string) server.RequestUserData {
+	t.Helper()
+	u, err := store.Registration(context.Background(), newUser(username))
+	require.NoError(t, err, "could not register user %q", username)
+	return u
+}
+
+// assertSameArticle compares articles. Times are compared by instant since stores may return them in different locations
+func assertSameArticle(t *testing.T, want, got server.Article) {
+	t.Helper()
+	assert.True(t, want.CreatedAt.Equal(got.CreatedAt), "expected creation time %v but got %v", want.CreatedAt, got.CreatedAt)
+	assert.True(t, want.UpdatedAt.Equal(got.UpdatedAt), "expected update time %v but got %v", want.UpdatedAt, got.UpdatedAt)
+	want.CreatedAt, want.UpdatedAt = got.CreatedAt, got.UpdatedAt
+	assert.Equal(t, want, got)
+}
+
+func assertIs(t *testing.T, err, target error) {
+	t.Helper()
+	assert.True(t, errors.Is(err, target), "expected %v but got %v", target, err)
+}
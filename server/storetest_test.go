@@ -0,0 +1,54 @@
+package server_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trapck/go-rest-api/server"
+	"github.com/trapck/go-rest-api/server/internal/testdb"
+	"github.com/trapck/go-rest-api/server/sqlite"
+	"github.com/trapck/go-rest-api/server/storetest"
+)
+
+func init() {
+	server.SetSQLiteTestDB(func(dsn string) (*server.DBBlogStore, error) {
+		store := &sqlite.BlogStore{DBBlogStore: server.DBBlogStore{DSN: dsn}}
+		return &store.DBBlogStore, store.Init()
+	})
+}
+
+func TestInMemoryBlogStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.BlogStore {
+		return server.NewInMemoryBlogStore()
+	})
+}
+
+func TestCachingBlogStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.BlogStore {
+		return server.NewCachingBlogStore(server.NewInMemoryBlogStore(), server.CacheOptions{Size: 100, TTL: time.Minute})
+	})
+}
+
+func TestPostgresBlogStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.BlogStore {
+		store := &server.DBBlogStore{DSN: testdb.Postgres(t)}
+		require.NoError(t, store.Init(), "postgres db was not opened")
+		t.Cleanup(func() { store.Close() })
+		_, err := store.MigrateUp()
+		require.NoError(t, err, "postgres db was not migrated")
+		return store
+	})
+}
+
+func TestSQLiteBlogStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.BlogStore {
+		store := &sqlite.BlogStore{DBBlogStore: server.DBBlogStore{DSN: server.SQLiteDSNScheme + filepath.Join(t.TempDir(), "blog.db")}}
+		require.NoError(t, store.Init(), "sqlite db was not opened")
+		t.Cleanup(func() { store.Close() })
+		_, err := store.MigrateUp()
+		require.NoError(t, err, "sqlite db was not migrated")
+		return store
+	})
+}